@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sebasmannem/bvvmoneymaker/pkg/bvv_mock"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8080", "address to listen on")
+	fixtures := flag.String("fixtures", "./testdata/mock", "folder with fixture files")
+	key := flag.String("key", os.Getenv("BVVMOCK_KEY"), "api key that clients should use")
+	secret := flag.String("secret", os.Getenv("BVVMOCK_SECRET"), "api secret to verify signatures with")
+	orders := flag.String("orders", "", "file to write posted orders to (one json object per line)")
+	flag.Parse()
+
+	server := bvv_mock.NewServer(*fixtures, *key, *secret)
+	if *orders != "" {
+		orderLog, err := os.OpenFile(*orders, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatalf("Error occurred on opening order log: %e", err)
+		}
+		defer orderLog.Close()
+		server.SetOrderLog(orderLog)
+	}
+	log.Printf("Serving Bitvavo mock on http://%s/v2 from %s", *listen, *fixtures)
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Fatal(httpServer.ListenAndServe())
+}
@@ -1,18 +1,51 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 
 	"github.com/sebasmannem/bvvmoneymaker/internal"
+	"github.com/shopspring/decimal"
 )
 
 func main() {
-	bvv, err := internal.NewBvvHandler()
+	config, err := internal.NewConfig()
 	if err != nil {
 		log.Fatalf("Error occurred on getting config: %e", err)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "backtest" {
+		backtest(config, os.Args[2:])
+		return
+	}
+	exchange, err := internal.NewExchange(config)
+	if err != nil {
+		log.Fatalf("Error occurred on creating exchange: %e", err)
+	}
+	bvv, err := internal.NewBvvHandler(config, exchange)
+	if err != nil {
+		log.Fatalf("Error occurred on connecting to exchange: %e", err)
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "halt":
+			if err = bvv.Halt(); err != nil {
+				log.Fatalf("Error occurred on halting: %e", err)
+			}
+			return
+		case "resume":
+			if err = bvv.Resume(); err != nil {
+				log.Fatalf("Error occurred on resuming: %e", err)
+			}
+			return
+		default:
+			log.Fatalf("Unknown command %s, use backtest, halt or resume", os.Args[1])
+		}
+	}
 
-	bvv.Evaluate()
+	if err = bvv.Evaluate(); err != nil {
+		log.Fatalf("Error occurred on evaluating markets: %e", err)
+	}
 	//balances, err := bvv.GetMarkets(false)
 	//if err != nil {
 	//	log.Fatalf("Error occurred on getting balances: %e", err)
@@ -25,3 +58,33 @@ func main() {
 	//bvv.GetMarkets()
 	//testWebsocket(bvv)
 }
+
+func backtest(config internal.BvvConfig, args []string) {
+	var options internal.BacktestOptions
+	var fiat float64
+	flags := flag.NewFlagSet("backtest", flag.ExitOnError)
+	flags.StringVar(&options.File, "file", "", "read candles from this file instead of downloading them")
+	flags.StringVar(&options.Save, "save", "", "save the candles to this file")
+	flags.StringVar(&options.Interval, "interval", "1d", "candle interval")
+	flags.IntVar(&options.Limit, "limit", 1000, "number of candles to download per market")
+	flags.Float64Var(&fiat, "fiat", 1000, "fiat to start with when paperTrading.balances is not configured")
+	flags.BoolVar(&options.Verbose, "verbose", false, "show the log of every evaluation")
+	if err := flags.Parse(args); err != nil {
+		log.Fatalf("Error occurred on parsing arguments: %e", err)
+	}
+	options.Fiat = decimal.NewFromFloat(fiat)
+
+	var exchange internal.Exchange
+	if options.File == "" {
+		exchange = internal.NewBitvavoExchange(config.Api)
+	}
+	bt, err := internal.NewBacktest(config, exchange, options)
+	if err != nil {
+		log.Fatalf("Error occurred on loading backtest: %e", err)
+	}
+	result, err := bt.Run()
+	if err != nil {
+		log.Fatalf("Error occurred on running backtest: %e", err)
+	}
+	result.Print()
+}
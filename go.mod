@@ -3,8 +3,8 @@ module github.com/sebasmannem/bvvmoneymaker
 go 1.16
 
 require (
-	github.com/bitvavo/go-bitvavo-api v1.2.0 // indirect
+	github.com/bitvavo/go-bitvavo-api v1.2.0
 	github.com/gorilla/websocket v1.4.2 // indirect
-	github.com/shopspring/decimal v1.2.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/shopspring/decimal v1.2.0
+	gopkg.in/yaml.v2 v2.4.0
 )
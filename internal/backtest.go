@@ -0,0 +1,526 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultBacktestInterval = "1d"
+	defaultBacktestLimit    = 1000
+	defaultBacktestFiat     = 1000
+)
+
+type BacktestOptions struct {
+	// File to read candles from. When not set, candles are downloaded with the exchange.
+	File string
+	// Save downloaded candles to this file, so they can be reused
+	Save     string
+	Interval string
+	Limit    int
+	// Fiat to start with when paperTrading.balances is not configured
+	Fiat    decimal.Decimal
+	Verbose bool
+}
+
+func (bo *BacktestOptions) SetDefaults() {
+	if bo.Interval == "" {
+		bo.Interval = defaultBacktestInterval
+	}
+	if bo.Limit == 0 {
+		bo.Limit = defaultBacktestLimit
+	}
+	if bo.Fiat.Equal(decimal.Zero) {
+		bo.Fiat = decimal.NewFromInt(defaultBacktestFiat)
+	}
+}
+
+// candleReplay is an Exchange which serves market data from historical candles up to a moving point in time.
+// It has no account, so it should be wrapped in a PaperExchange.
+type candleReplay struct {
+	interval string
+	// sorted old to new
+	candles map[string][]bitvavo.Candle
+	assets  []bitvavo.Assets
+	markets []bitvavo.Markets
+	now     int
+}
+
+func (cr *candleReplay) Time() (bitvavo.Time, error) {
+	return bitvavo.Time{Time: cr.now}, nil
+}
+
+func (cr *candleReplay) GetRemainingLimit() int {
+	return 1000
+}
+
+func (cr *candleReplay) Assets(options map[string]string) ([]bitvavo.Assets, error) {
+	return cr.assets, nil
+}
+
+func (cr *candleReplay) Markets(options map[string]string) (markets []bitvavo.Markets, err error) {
+	for _, market := range cr.markets {
+		if options["market"] == "" || options["market"] == market.Market {
+			markets = append(markets, market)
+		}
+	}
+	return markets, nil
+}
+
+// current returns the last candle of a market at this point in time
+func (cr *candleReplay) current(market string) (candle bitvavo.Candle, found bool) {
+	for _, c := range cr.candles[market] {
+		if c.Timestamp > cr.now {
+			break
+		}
+		candle, found = c, true
+	}
+	return candle, found
+}
+
+func (cr *candleReplay) TickerPrice(options map[string]string) (prices []bitvavo.TickerPrice, err error) {
+	for market := range cr.candles {
+		if options["market"] != "" && options["market"] != market {
+			continue
+		}
+		if candle, found := cr.current(market); found {
+			prices = append(prices, bitvavo.TickerPrice{Market: market, Price: candle.Close})
+		}
+	}
+	return prices, nil
+}
+
+// TickerBook has no spread in a backtest, bid and ask are both the close
+func (cr *candleReplay) TickerBook(options map[string]string) (books []bitvavo.TickerBook, err error) {
+	prices, err := cr.TickerPrice(options)
+	for _, price := range prices {
+		books = append(books, bitvavo.TickerBook{Market: price.Market, Bid: price.Price, Ask: price.Price})
+	}
+	return books, err
+}
+
+// Book has a single level at the close on both sides, with the volume of the candle
+func (cr *candleReplay) Book(market string, options map[string]string) (book bitvavo.Book, err error) {
+	candle, found := cr.current(market)
+	if !found {
+		return book, fmt.Errorf("backtest has no candles for market %s", market)
+	}
+	level := []string{candle.Close, candle.Volume}
+	return bitvavo.Book{Market: market, Bids: [][]string{level}, Asks: [][]string{level}}, nil
+}
+
+func (cr *candleReplay) Candles(market string, interval string, options map[string]string) (candles []bitvavo.Candle,
+	err error) {
+	if interval != cr.interval {
+		return nil, fmt.Errorf("backtest only has candles for interval %s, not %s", cr.interval, interval)
+	}
+	// Newest first, like Bitvavo does
+	all := cr.candles[market]
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].Timestamp <= cr.now {
+			candles = append(candles, all[i])
+		}
+	}
+	if limit, err := strconv.Atoi(options["limit"]); err == nil && limit < len(candles) {
+		candles = candles[:limit]
+	}
+	return candles, nil
+}
+
+func (cr *candleReplay) Balance(options map[string]string) ([]bitvavo.Balance, error) {
+	return nil, fmt.Errorf("candle replay has no balances")
+}
+
+func (cr *candleReplay) Account() (bitvavo.Account, error) {
+	return bitvavo.Account{}, fmt.Errorf("candle replay has no account")
+}
+
+func (cr *candleReplay) Trades(market string, options map[string]string) ([]bitvavo.Trades, error) {
+	return nil, fmt.Errorf("candle replay has no trades")
+}
+
+func (cr *candleReplay) PlaceOrder(market string, side string, orderType string,
+	body map[string]string) (bitvavo.Order, error) {
+	return bitvavo.Order{}, fmt.Errorf("candle replay cannot place orders")
+}
+
+func (cr *candleReplay) UpdateOrder(market string, orderId string, body map[string]string) (bitvavo.Order, error) {
+	return bitvavo.Order{}, fmt.Errorf("candle replay has no orders")
+}
+
+func (cr *candleReplay) CancelOrder(market string, orderId string) (bitvavo.CancelOrder, error) {
+	return bitvavo.CancelOrder{}, fmt.Errorf("candle replay has no orders")
+}
+
+func (cr *candleReplay) CancelOrders(options map[string]string) ([]bitvavo.CancelOrder, error) {
+	return nil, fmt.Errorf("candle replay has no orders")
+}
+
+func (cr *candleReplay) GetOrder(market string, orderId string) (bitvavo.Order, error) {
+	return bitvavo.Order{}, fmt.Errorf("candle replay has no orders")
+}
+
+func (cr *candleReplay) GetOrders(market string, options map[string]string) ([]bitvavo.Order, error) {
+	return nil, fmt.Errorf("candle replay has no orders")
+}
+
+func (cr *candleReplay) OrdersOpen(options map[string]string) ([]bitvavo.Order, error) {
+	return nil, fmt.Errorf("candle replay has no orders")
+}
+
+// steps returns all timestamps where every market has at least warmup candles
+func (cr *candleReplay) steps(warmup int) (steps []int) {
+	var start int
+	timestamps := make(map[int]bool)
+	for _, candles := range cr.candles {
+		if len(candles) <= warmup {
+			return nil
+		}
+		if candles[warmup].Timestamp > start {
+			start = candles[warmup].Timestamp
+		}
+		for _, candle := range candles {
+			timestamps[candle.Timestamp] = true
+		}
+	}
+	for ts := range timestamps {
+		if ts >= start {
+			steps = append(steps, ts)
+		}
+	}
+	sort.Ints(steps)
+	return steps
+}
+
+type Backtest struct {
+	config  BvvConfig
+	options BacktestOptions
+	replay  *candleReplay
+	wallet  *PaperExchange
+	state   *bvvState
+}
+
+type BacktestResult struct {
+	Trades     []bitvavo.Trades
+	Errors     int
+	StartValue decimal.Decimal
+	EndValue   decimal.Decimal
+	HoldValue  decimal.Decimal
+}
+
+// NewBacktest loads the candles for all configured markets, from options.File or with the exchange
+func NewBacktest(config BvvConfig, exchange Exchange, options BacktestOptions) (bt *Backtest, err error) {
+	options.SetDefaults()
+	// Orders are only placed in a simulated wallet, and the state is only kept in memory
+	config.ActiveMode = true
+	config.StateFile = ""
+	replay := &candleReplay{
+		interval: options.Interval,
+		candles:  make(map[string][]bitvavo.Candle),
+	}
+	for symbol, marketConfig := range config.Markets {
+		maConfig := marketConfig.MAConfig
+		maConfig.SetDefaults()
+		if maConfig.Interval != options.Interval && marketConfig.MAConfig.Enabled() {
+			return nil, fmt.Errorf("market %s uses interval %s, which does not match backtest interval %s",
+				symbol, maConfig.Interval, options.Interval)
+		}
+	}
+	if options.File != "" {
+		if err = replay.load(options.File); err != nil {
+			return nil, err
+		}
+	} else if err = replay.download(exchange, config, options.Limit); err != nil {
+		return nil, err
+	}
+	if options.Save != "" {
+		if err = replay.save(options.Save); err != nil {
+			return nil, err
+		}
+	}
+	if exchange != nil {
+		if replay.assets, err = exchange.Assets(bvvOptions{}); err != nil {
+			return nil, err
+		}
+		if replay.markets, err = exchange.Markets(bvvOptions{}); err != nil {
+			return nil, err
+		}
+	} else {
+		replay.assets = []bitvavo.Assets{{Symbol: config.Fiat, Decimals: 2}}
+		symbols := map[string]bool{config.Fiat: true}
+		for key := range config.Markets {
+			market := config.marketName(key)
+			base, quote, err := splitMarket(market)
+			if err != nil {
+				return nil, err
+			}
+			for _, symbol := range []string{base, quote} {
+				if !symbols[symbol] {
+					symbols[symbol] = true
+					replay.assets = append(replay.assets, bitvavo.Assets{Symbol: symbol, Decimals: 8})
+				}
+			}
+			// These are the rules of most EUR markets on Bitvavo, markets in crypto have a lower minimum
+			minQuote := "5"
+			if quote != config.Fiat {
+				minQuote = "0.0001"
+			}
+			replay.markets = append(replay.markets, bitvavo.Markets{
+				Status:               marketStatusTrading,
+				Base:                 base,
+				Quote:                quote,
+				Market:               market,
+				PricePrecision:       defaultPricePrecision,
+				MinOrderInQuoteAsset: minQuote,
+				MinOrderInBaseAsset:  "0",
+				OrderTypes:           []string{orderTypeMarket, orderTypeLimit, orderTypeStopLoss, orderTypeTakeProfit},
+			})
+		}
+	}
+	state, err := loadState(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Backtest{
+		config:  config,
+		options: options,
+		replay:  replay,
+		state:   state,
+	}, nil
+}
+
+func (cr *candleReplay) download(exchange Exchange, config BvvConfig, limit int) error {
+	for key := range config.Markets {
+		market := config.marketName(key)
+		candles, err := exchange.Candles(market, cr.interval, bvvOptions{"limit": fmt.Sprintf("%d", limit)})
+		if err != nil {
+			return fmt.Errorf("error downloading candles for %s: %e", market, err)
+		}
+		sort.Sort(candlesByTS(candles))
+		cr.candles[market] = candles
+	}
+	return nil
+}
+
+// load reads candles from a json file with a list of Bitvavo candles ([timestamp, open, high, low, close, volume])
+// per market
+func (cr *candleReplay) load(file string) error {
+	// The candle file is specified by the operator
+	// #nosec
+	jsonCandles, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var markets map[string][][]interface{}
+	if err = json.Unmarshal(jsonCandles, &markets); err != nil {
+		return err
+	}
+	for market, rows := range markets {
+		var candles []bitvavo.Candle
+		for _, row := range rows {
+			if len(row) != 6 {
+				return fmt.Errorf("invalid candle for %s: %v", market, row)
+			}
+			ts, ok := row[0].(float64)
+			if !ok {
+				return fmt.Errorf("invalid candle timestamp for %s: %v", market, row[0])
+			}
+			candle := bitvavo.Candle{Timestamp: int(ts)}
+			for i, field := range []*string{&candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume} {
+				if *field, ok = row[i+1].(string); !ok {
+					return fmt.Errorf("invalid candle for %s: %v", market, row)
+				}
+			}
+			candles = append(candles, candle)
+		}
+		sort.Sort(candlesByTS(candles))
+		cr.candles[market] = candles
+	}
+	return nil
+}
+
+func (cr *candleReplay) save(file string) error {
+	markets := make(map[string][][]interface{})
+	for market, candles := range cr.candles {
+		for _, c := range candles {
+			markets[market] = append(markets[market],
+				[]interface{}{c.Timestamp, c.Open, c.High, c.Low, c.Close, c.Volume})
+		}
+	}
+	jsonCandles, err := json.Marshal(markets)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, jsonCandles, 0600)
+}
+
+// warmup returns the number of candles the moving averages need before Evaluate can run
+func (bt *Backtest) warmup() (warmup int) {
+	for _, marketConfig := range bt.config.Markets {
+		if !marketConfig.MAConfig.Enabled() {
+			continue
+		}
+		maConfig := marketConfig.MAConfig
+		maConfig.SetDefaults()
+		if maConfig.Window > warmup {
+			warmup = maConfig.Window
+		}
+	}
+	return warmup
+}
+
+// value returns the value of a set of balances in fiat at the current point in time
+func (bt *Backtest) value(balances map[string]decimal.Decimal) (value decimal.Decimal, err error) {
+	tickerPrices, err := bt.replay.TickerPrice(bvvOptions{})
+	if err != nil {
+		return value, err
+	}
+	prices := make(map[string]decimal.Decimal)
+	for _, tickerPrice := range tickerPrices {
+		if prices[tickerPrice.Market], err = decimal.NewFromString(tickerPrice.Price); err != nil {
+			return value, err
+		}
+	}
+	for symbol, balance := range balances {
+		if balance.Equal(decimal.Zero) {
+			continue
+		}
+		price, err := resolvePrice(prices, symbol, bt.config.Fiat)
+		if err != nil {
+			return value, err
+		}
+		value = value.Add(balance.Mul(price))
+	}
+	return value, nil
+}
+
+// open creates the starting wallet. Configured crypto balances get an opening trade at the start price, so they
+// have a cost basis. Without configured balances, we start with fiat and buy
+// (slightly more than) `min` of every market.
+func (bt *Backtest) open() (err error) {
+	balances := make(map[string]decimal.Decimal)
+	for key := range bt.config.Markets {
+		base, quote, err := splitMarket(bt.config.marketName(key))
+		if err != nil {
+			return err
+		}
+		balances[base], balances[quote] = decimal.Zero, decimal.Zero
+	}
+	for symbol, balance := range bt.config.PaperTrading.Balances {
+		balances[symbol] = balance
+	}
+	if len(bt.config.PaperTrading.Balances) == 0 {
+		balances[bt.config.Fiat] = bt.options.Fiat
+	}
+	bt.wallet = newMemoryPaperExchange(bt.replay, bt.config.PaperTrading, balances)
+
+	for symbol, balance := range bt.config.PaperTrading.Balances {
+		if symbol == bt.config.Fiat || balance.Equal(decimal.Zero) {
+			continue
+		}
+		market := fmt.Sprintf("%s-%s", symbol, bt.config.Fiat)
+		candle, found := bt.replay.current(market)
+		if !found {
+			return fmt.Errorf("could not find price for market %s", market)
+		}
+		bt.wallet.wallet.Trades = append(bt.wallet.wallet.Trades, bitvavo.Trades{
+			Id:        fmt.Sprintf("open-%s", symbol),
+			Timestamp: bt.replay.now,
+			Market:    market,
+			Amount:    balance.String(),
+			Side:      "buy",
+			Price:     candle.Close,
+		})
+	}
+	if len(bt.config.PaperTrading.Balances) > 0 {
+		return nil
+	}
+	for key, marketConfig := range bt.config.Markets {
+		minLevel, err := decimal.NewFromString(marketConfig.MinLevel)
+		if err != nil || !minLevel.GreaterThan(decimal.Zero) {
+			continue
+		}
+		// We only start with fiat, so only markets that are bought with fiat (and have min in fiat) are opened
+		market := bt.config.marketName(key)
+		if _, quote, _ := splitMarket(market); quote != bt.config.Fiat ||
+			(marketConfig.LevelAsset != "" && marketConfig.LevelAsset != bt.config.Fiat) {
+			continue
+		}
+		// Open slightly above min, so the first evaluation does not top up rounding differences
+		amountQuote := minLevel.Mul(decimal.NewFromFloat(1.01))
+		if _, err = bt.wallet.PlaceOrder(market, "buy", "market",
+			bvvOptions{"amountQuote": amountQuote.String()}); err != nil {
+			return fmt.Errorf("could not open position in %s: %e", market, err)
+		}
+	}
+	return nil
+}
+
+// Run steps through time and runs Evaluate against the simulated wallet on every step
+func (bt *Backtest) Run() (result BacktestResult, err error) {
+	steps := bt.replay.steps(bt.warmup())
+	if len(steps) == 0 {
+		return result, fmt.Errorf("not enough candles to backtest with a moving average window of %d", bt.warmup())
+	}
+	bt.replay.now = steps[0]
+	if err = bt.open(); err != nil {
+		return result, err
+	}
+	initial := bt.wallet.Balances()
+	if result.StartValue, err = bt.value(initial); err != nil {
+		return result, err
+	}
+
+	logWriter := log.Writer()
+	if !bt.options.Verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+	for _, step := range steps {
+		bt.replay.now = step
+		bh, err := NewBvvHandler(bt.config, bt.wallet)
+		if err == nil {
+			bh.state = bt.state
+			err = bh.Evaluate()
+		}
+		if err != nil {
+			result.Errors++
+			log.Printf("Error in backtest step %d: %e", step, err)
+		}
+	}
+	log.SetOutput(logWriter)
+
+	result.Trades = bt.wallet.wallet.Trades
+	if result.EndValue, err = bt.value(bt.wallet.Balances()); err != nil {
+		return result, err
+	}
+	if result.HoldValue, err = bt.value(initial); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (br BacktestResult) Print() {
+	for _, trade := range br.Trades {
+		fmt.Printf("%d %-4s %-10s %s @ %s (fee %s)\n", trade.Timestamp, trade.Side, trade.Market, trade.Amount,
+			trade.Price, trade.Fee)
+	}
+	fmt.Printf("trades:        %d\n", len(br.Trades))
+	fmt.Printf("failed steps:  %d\n", br.Errors)
+	fmt.Printf("start value:   %s\n", br.StartValue.Round(2))
+	fmt.Printf("final value:   %s (%s%%)\n", br.EndValue.Round(2), growthPercent(br.StartValue, br.EndValue))
+	fmt.Printf("buy and hold:  %s (%s%%)\n", br.HoldValue.Round(2), growthPercent(br.StartValue, br.HoldValue))
+}
+
+func growthPercent(from decimal.Decimal, to decimal.Decimal) decimal.Decimal {
+	if from.Equal(decimal.Zero) {
+		return decimal.Zero
+	}
+	return to.Sub(from).Div(from).Mul(decimal.NewFromInt(100)).Round(2)
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// plannedBuy is a buy order of a strategy, which still needs to be funded
+type plannedBuy struct {
+	market *BvvMarket
+	order  PlannedOrder
+}
+
+func newPlannedBuy(market *BvvMarket, order PlannedOrder) plannedBuy {
+	return plannedBuy{market: market, order: order}
+}
+
+// price returns the price of one unit, including the fee
+func (pb plannedBuy) price() decimal.Decimal {
+	return pb.market.buyPrice()
+}
+
+// cost returns the amount of the quote asset that is needed for this buy. Buys are at least the minimum amount of the
+// market.
+func (pb plannedBuy) cost() decimal.Decimal {
+	return decimal.Max(pb.order.Amount, pb.market.MinimumAmount()).Mul(pb.price())
+}
+
+// underrated returns the percentage that the price is under the expected rate
+func (pb plannedBuy) underrated() (decimal.Decimal, error) {
+	expected, err := pb.market.GetExpectedRate()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimalPercent(expected, pb.market.Price), nil
+}
+
+// allocateBudget returns the buys that can be funded with the available balance of their quote asset. Every quote
+// asset has its own budget.
+func (bh BvvHandler) allocateBudget(buys []plannedBuy) (funded []plannedBuy, err error) {
+	byQuote := make(map[string][]plannedBuy)
+	var quotes []string
+	for _, buy := range buys {
+		if _, exists := byQuote[buy.market.To]; !exists {
+			quotes = append(quotes, buy.market.To)
+		}
+		byQuote[buy.market.To] = append(byQuote[buy.market.To], buy)
+	}
+	sort.Strings(quotes)
+	for _, quote := range quotes {
+		quoteFunded, err := bh.allocateQuote(quote, byQuote[quote])
+		if err != nil {
+			return nil, err
+		}
+		funded = append(funded, quoteFunded...)
+	}
+	return funded, nil
+}
+
+// allocateQuote returns the buys that can be funded with the available balance of a quote asset. When there is not
+// enough, buys are funded by priority (default), proportionally, or the most underrated market first. Buys which can
+// only be funded partially are lowered, and dropped when they would be below the minimum of the market.
+func (bh BvvHandler) allocateQuote(quote string, buys []plannedBuy) (funded []plannedBuy, err error) {
+	available := bh.balances[quote].Available
+	needed := decimal.Zero
+	for _, buy := range buys {
+		needed = needed.Add(buy.cost())
+	}
+	if needed.LessThanOrEqual(available) {
+		return buys, nil
+	}
+	log.Printf("Buys need %s %s, but only %s %s is available, allocating by %s", buys[0].market.roundQuote(needed),
+		quote, buys[0].market.roundQuote(available), quote, bh.config.BudgetAllocation)
+	sorted := make([]plannedBuy, len(buys))
+	copy(sorted, buys)
+	switch bh.config.BudgetAllocation {
+	case allocationPriority:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].market.config.Priority > sorted[j].market.config.Priority
+		})
+	case allocationUnderrated:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			// Markets without an expected rate go last
+			iUnderrated, iErr := sorted[i].underrated()
+			jUnderrated, jErr := sorted[j].underrated()
+			if iErr != nil || jErr != nil {
+				return iErr == nil && jErr != nil
+			}
+			return iUnderrated.GreaterThan(jUnderrated)
+		})
+	case allocationProportional:
+		share := available.Div(needed)
+		for _, buy := range sorted {
+			if buy, ok := bh.fund(buy, buy.cost().Mul(share)); ok {
+				funded = append(funded, buy)
+			}
+		}
+		return funded, nil
+	default:
+		return nil, fmt.Errorf("invalid budgetAllocation %s", bh.config.BudgetAllocation)
+	}
+	for _, buy := range sorted {
+		if buy, ok := bh.fund(buy, decimal.Min(buy.cost(), available)); ok {
+			funded = append(funded, buy)
+			available = available.Sub(buy.cost())
+		}
+	}
+	return funded, nil
+}
+
+// reserve moves an amount of an asset from available to in order, for an order that was placed after the balances
+// where read
+func (bh BvvHandler) reserve(symbol string, amount decimal.Decimal) {
+	balance := bh.balances[symbol]
+	balance.Available = decimal.Max(balance.Available.Sub(amount), decimal.Zero)
+	balance.InOrder = balance.InOrder.Add(amount)
+	bh.balances[symbol] = balance
+}
+
+// fund lowers the amount of a buy to what can be bought with budget
+func (bh BvvHandler) fund(buy plannedBuy, budget decimal.Decimal) (plannedBuy, bool) {
+	if budget.GreaterThanOrEqual(buy.cost()) {
+		return buy, true
+	}
+	amount := budget.Div(buy.price())
+	if amount.LessThan(buy.market.MinimumAmount()) {
+		log.Printf("%s: not buying, %s %s is not enough for the minimum order", buy.market.Name(),
+			buy.market.roundQuote(budget), buy.market.To)
+		return buy, false
+	}
+	log.Printf("%s: lowering buy from %s to %s to fit the budget", buy.market.Name(), buy.order.Amount, amount)
+	buy.order.Amount = amount
+	return buy, true
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/sebasmannem/bvvmoneymaker/pkg/moving_average"
+	"github.com/shopspring/decimal"
+)
+
+// fixedRate is a moving average with a fixed expected rate
+type fixedRate struct {
+	moving_average.MovingAverage
+	expected decimal.Decimal
+}
+
+func (fr fixedRate) GetWithOffset() (decimal.Decimal, error) {
+	return fr.expected, nil
+}
+
+// newBudgetHandler returns a handler with 100 EUR, and ADA and BTC markets with an expected rate
+func newBudgetHandler(t *testing.T, allocation string) (*BvvHandler, map[string]*BvvMarket) {
+	t.Helper()
+	config := BvvConfig{BudgetAllocation: allocation, Markets: map[string]bvvMarketConfig{
+		"ADA": {Priority: 10},
+		"BTC": {Priority: 1},
+	}}
+	bh := newTestHandler(t, config, newFakeExchange(), map[string]string{"ADA-EUR": "0.5", "BTC-EUR": "30000"})
+	bh.balances["EUR"] = assetBalance{Available: decimal.NewFromInt(100)}
+	markets := make(map[string]*BvvMarket)
+	for key, expected := range map[string]string{"ADA": "0.55", "BTC": "36000"} {
+		market := newTestMarket(t, bh, key, "0")
+		market.mah = &MAHandler{ema: fixedRate{expected: decimal.RequireFromString(expected)}}
+		markets[key] = &market
+	}
+	return bh, markets
+}
+
+func TestAllocateQuote(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		allocation string
+		buys       map[string]string
+		expected   map[string]string
+	}{
+		{name: "enough", allocation: allocationPriority, buys: map[string]string{"ADA": "100", "BTC": "0.001"},
+			expected: map[string]string{"ADA": "100", "BTC": "0.001"}},
+		{name: "priority", allocation: allocationPriority, buys: map[string]string{"ADA": "160", "BTC": "0.001"},
+			expected: map[string]string{"ADA": "160", "BTC": "0.00066667"}},
+		{name: "priority below minimum", allocation: allocationPriority,
+			buys: map[string]string{"ADA": "196", "BTC": "0.001"}, expected: map[string]string{"ADA": "196"}},
+		{name: "proportional", allocation: allocationProportional,
+			buys:     map[string]string{"ADA": "160", "BTC": "0.001"},
+			expected: map[string]string{"ADA": "145.45454545", "BTC": "0.00090909"}},
+		{name: "underrated", allocation: allocationUnderrated, buys: map[string]string{"ADA": "160", "BTC": "0.001"},
+			expected: map[string]string{"ADA": "140", "BTC": "0.001"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			bh, markets := newBudgetHandler(t, test.allocation)
+			var buys []plannedBuy
+			for _, key := range []string{"ADA", "BTC"} {
+				if amount, exists := test.buys[key]; exists {
+					buys = append(buys, newPlannedBuy(markets[key],
+						PlannedOrder{Side: "buy", Amount: decimal.RequireFromString(amount)}))
+				}
+			}
+			funded, err := bh.allocateQuote("EUR", buys)
+			if err != nil {
+				t.Fatalf("could not allocate budget: %v", err)
+			}
+			if len(funded) != len(test.expected) {
+				t.Fatalf("expected %v, got %d funded buys", test.expected, len(funded))
+			}
+			for _, buy := range funded {
+				expected, exists := test.expected[buy.market.From]
+				if !exists {
+					t.Errorf("expected %s not to be funded", buy.market.From)
+				} else if amount := buy.order.Amount.Round(8); !amount.Equal(decimal.RequireFromString(expected)) {
+					t.Errorf("expected %s %s, got %s", expected, buy.market.From, amount)
+				}
+			}
+		})
+	}
+}
+
+// TestAllocateAfterGrid checks that the buys of a grid, which are placed before the budget is allocated, are not
+// counted as available
+func TestAllocateAfterGrid(t *testing.T) {
+	bh, markets := newBudgetHandler(t, allocationPriority)
+	bh.config.ActiveMode = true
+	markets["ADA"].Available = decimal.NewFromInt(100)
+	grid := bvvGridConfig{Low: decimal.RequireFromString("0.4"), High: decimal.RequireFromString("0.6"), Levels: 3,
+		Amount: decimal.NewFromInt(20)}
+	if err := bh.maintainGrid(*markets["ADA"], grid); err != nil {
+		t.Fatalf("could not start grid: %v", err)
+	}
+	if available := bh.balances["EUR"].Available; !available.Equal(decimal.NewFromInt(92)) {
+		t.Fatalf("expected 92 EUR to be available after the grid buy of 8 EUR, got %s", available)
+	}
+	buy := PlannedOrder{Side: "buy", Amount: decimal.RequireFromString("0.004")}
+	buys := []plannedBuy{newPlannedBuy(markets["BTC"], buy)}
+	funded, err := bh.allocateQuote("EUR", buys)
+	if err != nil {
+		t.Fatalf("could not allocate budget: %v", err)
+	}
+	if len(funded) != 1 || !funded[0].order.Amount.Round(8).Equal(decimal.RequireFromString("0.00306667")) {
+		t.Errorf("expected a buy of 0.00306667 BTC, got %v", funded)
+	}
+}
+
+// TestAllocateBudgetPerQuote checks that buys in markets with another quote asset are funded with that asset
+func TestAllocateBudgetPerQuote(t *testing.T) {
+	config := BvvConfig{BudgetAllocation: allocationPriority, Markets: map[string]bvvMarketConfig{
+		"ADA": {}, "DOT-BTC": {},
+	}}
+	bh := newTestHandler(t, config, newFakeExchange(), map[string]string{"ADA-EUR": "0.5", "DOT-BTC": "0.001"})
+	bh.marketInfo["DOT-BTC"] = bitvavo.Markets{Status: marketStatusTrading, Base: "DOT", Quote: "BTC",
+		Market: "DOT-BTC", PricePrecision: 5, MinOrderInQuoteAsset: "0.0001", MinOrderInBaseAsset: "0.1"}
+	bh.balances["EUR"] = assetBalance{Available: decimal.NewFromInt(100)}
+	bh.balances["BTC"] = assetBalance{Available: decimal.RequireFromString("0.01")}
+	ada, dot := newTestMarket(t, bh, "ADA", "0"), newTestMarket(t, bh, "DOT-BTC", "0")
+	funded, err := bh.allocateBudget([]plannedBuy{
+		newPlannedBuy(&ada, PlannedOrder{Side: "buy", Amount: decimal.NewFromInt(100)}),
+		newPlannedBuy(&dot, PlannedOrder{Side: "buy", Amount: decimal.NewFromInt(20)}),
+	})
+	if err != nil {
+		t.Fatalf("could not allocate budget: %v", err)
+	}
+	expected := map[string]string{"ADA-EUR": "100", "DOT-BTC": "10"}
+	if len(funded) != len(expected) {
+		t.Fatalf("expected %v, got %d funded buys", expected, len(funded))
+	}
+	for _, buy := range funded {
+		if !buy.order.Amount.Equal(decimal.RequireFromString(expected[buy.market.Name()])) {
+			t.Errorf("expected %s for %s, got %s", expected[buy.market.Name()], buy.market.Name(), buy.order.Amount)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package internal
 import (
 	"fmt"
 	"log"
+	"sort"
 
 	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/sebasmannem/bvvmoneymaker/pkg/moving_average"
 	"github.com/shopspring/decimal"
 )
 
@@ -13,88 +15,235 @@ import (
 type bvvOptions map[string]string
 
 type BvvHandler struct {
-	connection *bitvavo.Bitvavo
+	connection Exchange
 	config     BvvConfig
 	markets    BvvMarkets
 	// internal temp list of current
 	prices map[string]decimal.Decimal
 	assets map[string]bitvavo.Assets
+	// the rules of all markets on the exchange, by market name
+	marketInfo map[string]bitvavo.Markets
+	state      *bvvState
+	// the balances of the account, by symbol
+	balances map[string]assetBalance
+	fees     tradingFees
+	// the time (in ms) that this run started, for the risk limits per run
+	runStart int
 }
 
-func NewBvvHandler() (bh *BvvHandler, err error) {
+// assetBalance is the amount of an asset which is available, and which is held by open orders
+type assetBalance struct {
+	Available decimal.Decimal
+	InOrder   decimal.Decimal
+}
+
+func NewBvvHandler(config BvvConfig, connection Exchange) (bh *BvvHandler, err error) {
 	log.Printf("BVV MoneyMaker version: %s", appVersion)
-	var config BvvConfig
-	if config, err = NewConfig(); err != nil {
+	handler := BvvHandler{
+		config:     config,
+		connection: connection,
+	}
+	if err = handler.GetAssets(); err != nil {
+		return bh, err
+	}
+	if err = handler.GetMarketInfo(); err != nil {
+		return bh, err
+	}
+	if err = handler.GetFees(); err != nil {
+		return bh, err
+	}
+	if handler.state, err = loadState(config.StateFile); err != nil {
+		return bh, fmt.Errorf("could not load state from %s: %e", config.StateFile, err)
+	}
+	now, err := connection.Time()
+	if err != nil {
 		return bh, err
-	} else {
-		connection := bitvavo.Bitvavo{
-			ApiKey:       config.Api.Key,
-			ApiSecret:    config.Api.Secret,
-			RestUrl:      "https://api.bitvavo.com/v2",
-			WsUrl:        "wss://ws.bitvavo.com/v2/",
-			AccessWindow: 10000,
-			Debugging:    config.Api.Debug,
-		}
-		handler := BvvHandler{
-			config:     config,
-			connection: &connection,
-		}
-		if err = handler.GetAssets(); err != nil {
-			return bh, err
-		}
-		return &handler, nil
 	}
+	handler.runStart = now.Time
+	return &handler, nil
 }
 
-func (bh BvvHandler) Evaluate() {
+func (bh BvvHandler) Evaluate() error {
+	if bh.state.Halted {
+		log.Printf("Not evaluating markets, trading is halted until resume is run")
+		return nil
+	}
 	markets, err := bh.GetMarkets(false)
 	if err != nil {
-		log.Fatalf("Error occurred on getting markets: %e", err)
+		return fmt.Errorf("error occurred on getting markets: %e", err)
 	}
+	// Sells are placed right away, buys are placed when all markets are evaluated and the budget is known
+	var buys []plannedBuy
+	placed := make(map[string]bool)
 	for _, market := range markets.Sorted() {
-		if market.To != bh.config.Fiat {
-			// This probably is a reverse market. Skipping.
-			continue
+		orders, err := bh.planOrders(market)
+		if err != nil {
+			return err
 		}
-		if market.mah != nil {
-			expectedRate, err := market.GetExpectedRate()
-			if err != nil {
-				log.Fatalf("Error occurred on getting GetExpectedRate for market %s: %e", market.Name(), err)
+		for _, order := range orders {
+			log.Printf("%s: %s %s (%s), %s", market.Name(), order.Side, order.Amount, order.Reason,
+				market.describeOrder(order))
+			if pending := market.Pending(order.Side); pending.GreaterThan(decimal.Zero) {
+				log.Printf("%s: not placing %s order, %s is still in order", market.Name(), order.Side, pending)
+				continue
+			}
+			switch order.Side {
+			case "sell":
+				placed[market.Name()] = true
+				// Protective orders hold the funds we want to sell. They are placed again on the next run.
+				if err = bh.cancelProtection(*market); err == nil {
+					err = bh.Sell(*market, order.Amount)
+				}
+			case "buy":
+				buys = append(buys, newPlannedBuy(market, order))
+			default:
+				err = fmt.Errorf("invalid side %s", order.Side)
+			}
+			if err = bh.checkOrderError(*market, order, err); err != nil {
+				return err
+			}
+		}
+	}
+	if len(buys) > 0 {
+		if len(placed) > 0 && bh.config.placeOrders() {
+			// Sells might have added to the balances that buys are funded with
+			if err = bh.getBalances(); err != nil {
+				return fmt.Errorf("error occurred on getting balances: %e", err)
 			}
-			var direction string
-			var percent decimal.Decimal
-			hundred := decimal.NewFromInt(100)
-			if expectedRate.GreaterThan(market.Price) {
-				direction = "under"
-				percent = hundred.Sub(market.Price.Div(expectedRate).Mul(hundred))
+		}
+		funded, err := bh.allocateBudget(buys)
+		if err != nil {
+			return err
+		}
+		for _, buy := range funded {
+			placed[buy.market.Name()] = true
+			if buy.order.DCA {
+				err = bh.buyDCA(*buy.market, buy.order.Amount)
 			} else {
-				direction = "over"
-				percent = hundred.Sub(expectedRate.Div(market.Price).Mul(hundred))
+				err = bh.Buy(*buy.market, buy.order.Amount)
 			}
-			log.Printf("%s is %s%% %srated (expected %s vs actual %s)\n", market.Name(), percent.Round(2),
-				direction, expectedRate.Round(2), market.Price)
-			bw, err := market.GetBandWidth()
-			if err != nil {
-				log.Fatalf("Error occurred on getting GetBandWidth for market %s: %e", market.Name(), err)
+			if err = bh.checkOrderError(*buy.market, buy.order, err); err != nil {
+				return err
 			}
+		}
+	}
+	for _, market := range markets.Sorted() {
+		// When the position changed, protective orders are updated on the next run
+		if placed[market.Name()] {
+			continue
+		}
+		if err = bh.maintainProtection(*market); err != nil {
+			return fmt.Errorf("error occurred on maintaining protective orders for market %s: %e",
+				market.Name(), err)
+		}
+	}
+	return nil
+}
+
+// planOrders follows up on the orders of a market and returns the orders the strategy wants to place
+func (bh BvvHandler) planOrders(market *BvvMarket) (orders []PlannedOrder, err error) {
+	open, err := bh.updateTrackedOrders(*market)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred on tracking orders for market %s: %e", market.Name(), err)
+	}
+	if open, err = bh.handleUnfilled(*market, open); err != nil {
+		return nil, fmt.Errorf("error occurred on handling unfilled orders for market %s: %e", market.Name(), err)
+	}
+	if err = market.setPending(open); err != nil {
+		return nil, err
+	}
+	if err = bh.report(*market); err != nil {
+		return nil, err
+	}
+	strategy, err := newStrategy(&bh, market.config)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred on getting strategy for market %s: %e", market.Name(), err)
+	}
+	orders, err = strategy.Evaluate(*market)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred on evaluating strategy for market %s: %e", market.Name(), err)
+	}
+	if orders, err = bh.addDCA(*market, orders); err != nil {
+		return nil, fmt.Errorf("error occurred on planning dca for market %s: %e", market.Name(), err)
+	}
+	if orders, err = bh.applyTrailingStop(*market, orders); err != nil {
+		return nil, fmt.Errorf("error occurred on applying trailing stop for market %s: %e", market.Name(), err)
+	}
+	return orders, nil
+}
+
+// checkOrderError logs orders that where rejected because of the market rules, and wraps all other errors
+func (bh BvvHandler) checkOrderError(market BvvMarket, order PlannedOrder, err error) error {
+	if rErr, ok := err.(OrderRejectedError); ok {
+		log.Printf("%s.\n", rErr.Error())
+	} else if err != nil {
+		return fmt.Errorf("error occurred while placing %s order for %s: %e", order.Side, market.Name(), err)
+	}
+	return nil
+}
+
+// report logs the EMA indicators and the levels of a market
+func (bh BvvHandler) report(market BvvMarket) error {
+	if market.mah != nil {
+		expectedRate, err := market.GetExpectedRate()
+		if err != nil {
+			return fmt.Errorf("error occurred on getting GetExpectedRate for market %s: %e", market.Name(), err)
+		}
+		var direction string
+		var percent decimal.Decimal
+		hundred := decimal.NewFromInt(100)
+		if expectedRate.GreaterThan(market.Price) {
+			direction = "under"
+			percent = hundred.Sub(market.Price.Div(expectedRate).Mul(hundred))
+		} else {
+			direction = "over"
+			percent = hundred.Sub(expectedRate.Div(market.Price).Mul(hundred))
+		}
+		log.Printf("%s is %s%% %srated (expected %s vs actual %s)\n", market.Name(), percent.Round(2),
+			direction, market.roundQuote(expectedRate), market.Price)
+		bw, err := market.GetBandWidth()
+		if err != nil {
+			return fmt.Errorf("error occurred on getting GetBandWidth for market %s: %e", market.Name(), err)
+		}
+		if volatility, err := market.mah.GetATRPercent(); err == nil {
+			log.Printf("%s bandwidth is between -%s%% and +%s%%, volatility (ATR) is %s%%.\n", market.Name(),
+				bw.GetMinPercent().Round(2), bw.GetMaxPercent().Round(2), volatility.Round(2))
+		} else {
 			log.Printf("%s bandwidth is between -%s%% and +%s%%.\n", market.Name(), bw.GetMinPercent().Round(2),
 				bw.GetMaxPercent().Round(2))
 		}
-		log.Printf("%s: min: %s, max: %s, total: %s", market.Name(), market.Min.String(), market.Max.String(), market.Total().String())
-		if market.Max.GreaterThan(decimal.Zero) && market.Max.LessThan(market.Total()) {
-			err := bh.Sell(*market, market.Total().Sub(market.Max))
-			if err != nil {
-				log.Fatalf("Error occurred while selling %s: %e", market.Name(), err)
+		bh.reportIndicators(market)
+	}
+	log.Printf("%s: min: %s, max: %s, total: %s", market.Name(), market.Min.String(), market.Max.String(),
+		market.Total().String())
+	if market.PendingBuy.GreaterThan(decimal.Zero) || market.PendingSell.GreaterThan(decimal.Zero) {
+		log.Printf("%s: pending buy: %s, pending sell: %s, projected total: %s", market.Name(), market.PendingBuy,
+			market.PendingSell, market.Projected())
+	}
+	return nil
+}
+
+// reportIndicators logs all configured indicators of a market which are warmed up
+func (bh BvvHandler) reportIndicators(market BvvMarket) {
+	for _, name := range market.mah.IndicatorNames() {
+		indicator, err := market.mah.GetIndicator(name)
+		if err != nil || !indicator.Ready() {
+			continue
+		}
+		switch i := indicator.(type) {
+		case *moving_average.MACD:
+			if macd, err := i.Get(); err == nil {
+				log.Printf("%s %s is %s (signal %s, histogram %s).\n", market.Name(), name, macd.MACD.Round(4),
+					macd.Signal.Round(4), macd.Histogram.Round(4))
 			}
-		} else if avgRate, err := market.rate.Average(); err != nil {
-			log.Printf("Could not determine average rate from market %s", market.Name())
-		} else if avgRate.GreaterThan(market.Price) && !market.config.BuyUnderwater && !bh.config.BuyUnderwater {
-			log.Printf("market %s is %s%% under water (%s>%s)", market.Name(),
-				decimalPercent(avgRate, market.Price), avgRate, market.Price)
-		} else if market.Min.GreaterThan(decimal.Zero) && market.Min.GreaterThan(market.Total()) {
-			err := bh.Buy(*market, market.Min.Sub(market.Total()))
-			if err != nil {
-				log.Fatalf("Error occurred while buying %s: %e", market.Name(), err)
+		case *moving_average.BollingerBands:
+			if bb, err := i.Get(); err == nil {
+				log.Printf("%s %s is %s - %s - %s.\n", market.Name(), name, market.roundQuote(bb.Lower),
+					market.roundQuote(bb.Middle), market.roundQuote(bb.Upper))
+			}
+		default:
+			if value, err := i.Value(); err == nil {
+				log.Printf("%s %s is %s.\n", market.Name(), name, value.Round(4))
 			}
 		}
 	}
@@ -143,89 +292,225 @@ func (bh *BvvHandler) GetMarkets(reset bool) (markets BvvMarkets, err error) {
 	if err != nil {
 		return markets, err
 	}
-	balanceResponse, balanceErr := bh.connection.Balance(bvvOptions{})
-	if balanceErr != nil {
+	if err = bh.getBalances(); err != nil {
 		return markets, err
-	} else {
-		for _, b := range balanceResponse {
-			if b.Symbol == bh.config.Fiat {
-				continue
-			}
-			_, err := NewBvvMarket(bh, b.Symbol, bh.config.Fiat, b.Available, b.InOrder)
-			if mErr, ok := err.(MarketNotInConfigError); ok {
-				if bh.config.Debug {
-					log.Printf("%s.\n", mErr.Error())
-				}
-				continue
-			}
-			if err != nil {
-				return bh.markets, err
+	}
+	var keys []string
+	for key := range bh.config.Markets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		base, _, err := splitMarket(bh.config.marketName(key))
+		if err != nil {
+			return bh.markets, err
+		}
+		balance, held := bh.balances[base]
+		// Markets with a target weight are bought into, also without a balance
+		if !held && !bh.config.Markets[key].TargetWeight.GreaterThan(decimal.Zero) {
+			if bh.config.Debug {
+				log.Printf("Skipping market %s, there is no %s balance.\n", bh.config.marketName(key), base)
 			}
+			continue
+		}
+		if _, err = NewBvvMarket(bh, key, balance.Available, balance.InOrder); err != nil {
+			return bh.markets, err
 		}
 	}
 	return bh.markets, nil
 }
 
-func (bh BvvHandler) Sell(market BvvMarket, amount decimal.Decimal) (err error) {
-	if market.MinimumAmount().GreaterThan(amount) {
-		amount = market.MinimumAmount()
-	}
-	if !bh.config.ActiveMode {
-		log.Printf("We should sell %s: %s\n", market.Name(), amount)
-		bh.PrettyPrint(market.inverse)
-		return nil
-	}
-	log.Printf("I am selling %s: %s\n", market.Name(), amount)
-	var decimals int32
-	if asset, exists := bh.assets[market.From]; !exists {
-		return fmt.Errorf("unknown asset %s", market.From)
-	} else {
-		decimals = int32(asset.Decimals)
-	}
-
-	bh.PrettyPrint(market.inverse)
-	placeOrderResponse, err := bh.connection.PlaceOrder(
-		market.Name(),
-		"sell",
-		"market",
-		bvvOptions{"amount": amount.Round(decimals).String()})
+// getBalances gets the balances of all assets of the account
+func (bh *BvvHandler) getBalances() error {
+	balanceResponse, err := bh.connection.Balance(bvvOptions{})
 	if err != nil {
 		return err
-	} else {
-		bh.PrettyPrint(placeOrderResponse)
+	}
+	bh.balances = make(map[string]assetBalance)
+	for _, b := range balanceResponse {
+		var balance assetBalance
+		if balance.Available, err = decimal.NewFromString(b.Available); err != nil {
+			return fmt.Errorf("could not convert available to Decimal %s: %e", b.Available, err)
+		}
+		if balance.InOrder, err = decimal.NewFromString(b.InOrder); err != nil {
+			return fmt.Errorf("could not convert inOrder to Decimal %s: %e", b.InOrder, err)
+		}
+		bh.balances[b.Symbol] = balance
 	}
 	return nil
 }
 
+// portfolioValue returns the value in fiat of the fiat balance and the balances of all assets of configured markets
+func (bh BvvHandler) portfolioValue() (value decimal.Decimal, err error) {
+	assets := map[string]bool{bh.config.Fiat: true}
+	for _, market := range bh.markets {
+		assets[market.From], assets[market.To] = true, true
+	}
+	for asset := range assets {
+		balance := bh.balances[asset]
+		if balance.Available.Add(balance.InOrder).Equal(decimal.Zero) {
+			continue
+		}
+		price, err := bh.price(asset, bh.config.Fiat)
+		if err != nil {
+			return value, err
+		}
+		value = value.Add(balance.Available.Add(balance.InOrder).Mul(price))
+	}
+	return value, nil
+}
+
+func (bh BvvHandler) Sell(market BvvMarket, amount decimal.Decimal) (err error) {
+	_, err = bh.placeOrder(market, "sell", amount, "")
+	return err
+}
+
 func (bh BvvHandler) Buy(market BvvMarket, amount decimal.Decimal) (err error) {
-	if market.MinimumAmount().GreaterThan(amount) {
-		amount = market.MinimumAmount()
+	_, err = bh.placeOrder(market, "buy", amount, "")
+	return err
+}
+
+// placeOrder places a market or limit order (as configured for the market) for amount of market.From.
+// The amount is rounded to the decimals of the asset before it is checked against the risk limits.
+// The slot is part of the client order id, and onExchange is true when the order was placed now or earlier in this
+// window.
+func (bh BvvHandler) placeOrder(market BvvMarket, side string, amount decimal.Decimal, slot string) (onExchange bool,
+	err error) {
+	options := make(bvvOptions)
+	orderType := market.config.OrderType
+	price := market.Price
+	switch orderType {
+	case "", orderTypeMarket:
+		orderType = orderTypeMarket
+	case orderTypeLimit:
+		if price, err = bh.limitPrice(market, side); err != nil {
+			return false, err
+		}
+		options["price"] = price.String()
+		if market.config.TimeInForce != "" {
+			options["timeInForce"] = market.config.TimeInForce
+		}
+	default:
+		return false, fmt.Errorf("invalid orderType %s for market %s", orderType, market.Name())
 	}
-	if !bh.config.ActiveMode {
-		log.Printf("We should buy %s: %s\n", market.Name(), amount)
-		bh.PrettyPrint(market.inverse)
-		return nil
+	minimum := market.minimumAmountAt(price)
+	if minimum.GreaterThan(amount) {
+		amount = minimum
+	}
+	if orderType == orderTypeMarket && market.config.MaxSlippagePercent.GreaterThan(decimal.Zero) {
+		if amount, err = bh.limitSlippage(market, side, amount); err != nil {
+			return false, err
+		}
 	}
-	log.Printf("I am buying %s: %s\n", market.Name(), amount)
 	var decimals int32
 	if asset, exists := bh.assets[market.From]; !exists {
-		return fmt.Errorf("unknown asset %s", market.From)
+		return false, fmt.Errorf("unknown asset %s", market.From)
 	} else {
 		decimals = int32(asset.Decimals)
 	}
-	//log.Fatal("Not actually buying yet!!!")
-	bh.PrettyPrint(market.inverse)
-	placeOrderResponse, err := bh.connection.PlaceOrder(
-		market.Name(),
-		"buy",
-		"market",
-		bvvOptions{"amount": amount.Round(decimals).String()})
+	if rounded := amount.Round(decimals); rounded.LessThan(minimum) {
+		amount = roundUp(amount, decimals)
+	} else {
+		amount = rounded
+	}
+	if !bh.config.placeOrders() {
+		log.Printf("We should %s %s: %s\n", side, market.Name(), amount)
+		bh.PrettyPrint(market)
+		return false, nil
+	}
+	log.Printf("I am %sing %s: %s\n", side, market.Name(), amount)
+	bh.PrettyPrint(market)
+	placeOrderResponse, placed, err := bh.submitWithinLimits(market, side, orderType, slot, amount, price, options)
 	if err != nil {
-		return err
+		return placed, err
+	} else if !placed {
+		if _, tracked := bh.state.Orders[placeOrderResponse.OrderId]; tracked || !isOpen(placeOrderResponse) {
+			return true, nil
+		}
 	} else {
 		bh.PrettyPrint(placeOrderResponse)
 	}
-	return nil
+	return true, bh.trackOrder(placeOrderResponse)
+}
+
+// limitPrice returns the price for a limit order, which is limitOffset percent below the best bid (for buying) or
+// above the best ask (for selling)
+func (bh BvvHandler) limitPrice(market BvvMarket, side string) (price decimal.Decimal, err error) {
+	books, err := bh.connection.TickerBook(bvvOptions{"market": market.Name()})
+	if err != nil {
+		return price, err
+	}
+	for _, book := range books {
+		if book.Market != market.Name() {
+			continue
+		}
+		offset := market.config.LimitOffset.Div(decimal.NewFromInt(100))
+		if side == "buy" {
+			if price, err = decimal.NewFromString(book.Bid); err != nil {
+				return price, fmt.Errorf("invalid bid for market %s: %e", market.Name(), err)
+			}
+			price = price.Mul(decimal.NewFromInt(1).Sub(offset))
+		} else {
+			if price, err = decimal.NewFromString(book.Ask); err != nil {
+				return price, fmt.Errorf("invalid ask for market %s: %e", market.Name(), err)
+			}
+			price = price.Mul(decimal.NewFromInt(1).Add(offset))
+		}
+		return market.roundPrice(price), nil
+	}
+	return price, fmt.Errorf("could not find ticker book for market %s", market.Name())
+}
+
+// handleUnfilled cancels, re-prices or keeps limit orders which are still open from a previous run.
+// It returns the orders that are still open.
+func (bh BvvHandler) handleUnfilled(market BvvMarket, orders []bitvavo.Order) (open []bitvavo.Order, err error) {
+	if market.config.OrderType != orderTypeLimit || !bh.config.placeOrders() {
+		return orders, nil
+	}
+	for _, order := range orders {
+		if order.OrderType != orderTypeLimit || bh.isGridOrder(market, order.OrderId) {
+			open = append(open, order)
+			continue
+		}
+		switch market.config.Unfilled {
+		case unfilledCancel:
+			log.Printf("Cancelling unfilled %s order %s for %s", order.Side, order.OrderId, market.Name())
+			if _, err = bh.connection.CancelOrder(market.Name(), order.OrderId); err != nil {
+				return open, err
+			}
+			// Settle the order now, so it does not count for the risk limits when it is placed again
+			if _, tracked := bh.state.Orders[order.OrderId]; tracked {
+				canceled, err := bh.connection.GetOrder(market.Name(), order.OrderId)
+				if err != nil {
+					return open, fmt.Errorf("could not get order %s: %e", order.OrderId, err)
+				}
+				if err = bh.updateTrackedOrder(order.OrderId, canceled); err != nil {
+					return open, err
+				}
+			}
+			continue
+		case unfilledReprice:
+			price, err := bh.limitPrice(market, order.Side)
+			if err != nil {
+				return open, err
+			}
+			if current, err := decimal.NewFromString(order.Price); err != nil || !current.Equal(price) {
+				log.Printf("Re-pricing unfilled %s order %s for %s to %s", order.Side, order.OrderId,
+					market.Name(), price)
+				if _, err = bh.connection.UpdateOrder(market.Name(), order.OrderId,
+					bvvOptions{"price": price.String()}); err != nil {
+					return open, err
+				}
+			}
+		case unfilledKeep:
+			log.Printf("Keeping unfilled %s order %s for %s", order.Side, order.OrderId, market.Name())
+		default:
+			return open, fmt.Errorf("invalid unfilled option %s for market %s", market.config.Unfilled,
+				market.Name())
+		}
+		open = append(open, order)
+	}
+	return open, bh.state.save()
 }
 
 //func (bh BvvHandler) GetMarkets() (err error) {
@@ -260,6 +545,22 @@ func (bh *BvvHandler) GetAssets() (err error) {
 	return nil
 }
 
+func (bh *BvvHandler) GetMarketInfo() (err error) {
+	if len(bh.marketInfo) > 0 {
+		return nil
+	}
+	bh.marketInfo = make(map[string]bitvavo.Markets)
+	marketsResponse, marketsErr := bh.connection.Markets(bvvOptions{})
+	if marketsErr != nil {
+		return marketsErr
+	} else {
+		for _, market := range marketsResponse {
+			bh.marketInfo[market.Market] = market
+		}
+	}
+	return nil
+}
+
 func (bh BvvHandler) PrettyPrint(v interface{}) {
 	if bh.config.Debug {
 		err := PrettyPrint(v)
@@ -5,6 +5,7 @@ import (
 	"log"
 	"sort"
 
+	"github.com/bitvavo/go-bitvavo-api"
 	"github.com/sebasmannem/bvvmoneymaker/pkg/moving_average"
 	"github.com/shopspring/decimal"
 )
@@ -32,12 +33,22 @@ func newMarketNotInConfigError(marketName string) MarketNotInConfigError {
 	}
 }
 
+// OrderRejectedError is returned for orders that break the rules of a market, before they are sent to the exchange
+type OrderRejectedError struct {
+	error
+}
+
+func newOrderRejectedError(marketName string, format string, a ...interface{}) OrderRejectedError {
+	return OrderRejectedError{
+		fmt.Errorf("rejected order for market %s: %s", marketName, fmt.Sprintf(format, a...)),
+	}
+}
+
 type BvvMarket struct {
 	From      string `yaml:"symbol"`
 	To        string `yaml:"fiat"`
 	handler   *BvvHandler
 	config    bvvMarketConfig
-	inverse   *BvvMarket
 	Available decimal.Decimal `yaml:"available"`
 	InOrder   decimal.Decimal `yaml:"inOrder"`
 	Price     decimal.Decimal `yaml:"price"`
@@ -45,17 +56,23 @@ type BvvMarket struct {
 	Max       decimal.Decimal `yaml:"max"`
 	mah       *MAHandler
 	rate      Rate
+	info      bitvavo.Markets
+
+	// Amounts that are still to be bought or sold by open orders
+	PendingBuy  decimal.Decimal `yaml:"pendingBuy"`
+	PendingSell decimal.Decimal `yaml:"pendingSell"`
 }
 
-func NewBvvMarket(bh *BvvHandler, symbol string, fiatSymbol, available string, inOrder string) (market BvvMarket,
+// NewBvvMarket creates the market of a key in the markets config, with the balance of its base asset
+func NewBvvMarket(bh *BvvHandler, key string, available decimal.Decimal, inOrder decimal.Decimal) (market BvvMarket,
 	err error) {
 	var (
 		decMin decimal.Decimal
 		decMax decimal.Decimal
 	)
-	config, found := bh.config.Markets[symbol]
+	config, found := bh.config.Markets[key]
 	if !found {
-		return market, newMarketNotInConfigError(symbol)
+		return market, newMarketNotInConfigError(key)
 	}
 
 	if decMin, err = decimal.NewFromString(config.MinLevel); err != nil {
@@ -68,22 +85,18 @@ func NewBvvMarket(bh *BvvHandler, symbol string, fiatSymbol, available string, i
 	} else if decMax.LessThan(decMin) {
 		decMax = decimal.Zero
 	}
-	decAvailable, err := decimal.NewFromString(available)
-	if err != nil {
-		return market, fmt.Errorf("could not convert available to Decimal %s: %e", available, err)
-	}
-	decInOrder, err := decimal.NewFromString(inOrder)
-	if err != nil {
-		return market, fmt.Errorf("could not convert inOrder to Decimal %s: %e", inOrder, err)
-	}
 
 	market = BvvMarket{
-		From:      symbol,
-		To:        fiatSymbol,
 		handler:   bh,
 		config:    config,
-		Available: decAvailable,
-		InOrder:   decInOrder,
+		Available: available,
+		InOrder:   inOrder,
+	}
+	if market.From, market.To, err = splitMarket(bh.config.marketName(key)); err != nil {
+		return BvvMarket{}, err
+	}
+	if market.info, found = bh.marketInfo[market.Name()]; !found {
+		return BvvMarket{}, fmt.Errorf("could not find market info for %s", market.Name())
 	}
 	if err = market.SetAvgRate(); err != nil {
 		return BvvMarket{}, err
@@ -92,39 +105,36 @@ func NewBvvMarket(bh *BvvHandler, symbol string, fiatSymbol, available string, i
 	if config.MAConfig.Enabled() {
 		market.mah, err = NewMAHandler(&market, config.MAConfig)
 		if err != nil {
-			return BvvMarket{}, nil
+			return BvvMarket{}, fmt.Errorf("could not create moving average for market %s: %e", market.Name(), err)
 		}
 	}
 	err = market.setPrice(bh.prices)
 	if err != nil {
 		return BvvMarket{}, err
 	}
-	market.inverse, err = market.reverse()
-	market.inverse.inverse = &market
 
+	// Min and Max are expressed in the level asset, so we convert them to the base asset at the current price
+	levelAsset := config.LevelAsset
+	if levelAsset == "" {
+		levelAsset = bh.config.Fiat
+	}
+	levelPrice, err := bh.price(levelAsset, market.From)
+	if err != nil {
+		return BvvMarket{}, err
+	}
 	if decMin.Equal(decimal.Zero) {
 		log.Printf("Disabling Min for %s\n", market.Name())
-		market.inverse.Min = decimal.Zero
 		market.Min = decimal.Zero
 	} else {
-		// Because Max and Min are in EUR, not in Crypto, we set them in inverse and calculate for market from inverse
-		market.inverse.Min = decMin
-		market.Min = market.inverse.exchange(decMin)
+		market.Min = levelPrice.Mul(decMin)
 	}
 	if decMax.Equal(decimal.Zero) {
 		log.Printf("Disabling Max for %s\n", market.Name())
-		market.inverse.Max = decimal.Zero
 		market.Max = decimal.Zero
 	} else {
-		// Because Max and Min are in EUR, not in Crypto, we set them in inverse and calculate for market from inverse
-		market.inverse.Max = decMax
-		market.Max = market.inverse.exchange(decMax)
-	}
-	if err != nil {
-		return BvvMarket{}, err
+		market.Max = levelPrice.Mul(decMax)
 	}
 	bh.markets[market.Name()] = &market
-	bh.markets[market.inverse.Name()] = market.inverse
 	return market, nil
 }
 
@@ -150,26 +160,68 @@ func (bm *BvvMarket) SetAvgRate() error {
 	return nil
 }
 
+// MinimumAmount returns the smallest amount of From that can be ordered on this market at the current price
 func (bm BvvMarket) MinimumAmount() decimal.Decimal {
-	return decimal.NewFromInt32(5).Div(bm.Price)
+	return bm.minimumAmountAt(bm.Price)
 }
 
-func (bm BvvMarket) reverse() (reverse *BvvMarket, err error) {
-	if bm.Price.Equal(decimal.NewFromInt32(0)) {
-		return &BvvMarket{}, fmt.Errorf("cannot create a reverse when the prise is 0")
+// minimumAmountAt returns the smallest amount of From that can be ordered on this market at a price
+func (bm BvvMarket) minimumAmountAt(price decimal.Decimal) decimal.Decimal {
+	minimum, err := decimal.NewFromString(bm.info.MinOrderInBaseAsset)
+	if err != nil {
+		minimum = decimal.Zero
 	}
-	reverse = &BvvMarket{
-		From:      bm.To,
-		To:        bm.From,
-		Price:     decimal.NewFromInt32(1).Div(bm.Price),
-		Available: bm.exchange(bm.Available),
-		InOrder:   bm.exchange(bm.InOrder),
+	minQuote, err := decimal.NewFromString(bm.info.MinOrderInQuoteAsset)
+	if err == nil && price.GreaterThan(decimal.Zero) {
+		minimum = decimal.Max(minimum, minQuote.Div(price))
 	}
-	return reverse, nil
+	return minimum
+}
+
+// roundPrice rounds a price to the number of significant digits that this market accepts
+func (bm BvvMarket) roundPrice(price decimal.Decimal) decimal.Decimal {
+	return roundSignificant(price, int32(bm.info.PricePrecision))
 }
 
-func (bm BvvMarket) exchange(amount decimal.Decimal) (balance decimal.Decimal) {
-	return bm.Price.Mul(amount)
+// roundQuote rounds an amount of the quote asset to the number of decimals of that asset, for logging
+func (bm BvvMarket) roundQuote(amount decimal.Decimal) decimal.Decimal {
+	decimals := int32(2)
+	if bm.handler != nil {
+		if asset, exists := bm.handler.assets[bm.To]; exists {
+			decimals = int32(asset.Decimals)
+		}
+	}
+	return amount.Round(decimals)
+}
+
+// checkOrder returns an OrderRejectedError when an order breaks the rules of this market.
+// For market orders, price is the current price.
+func (bm BvvMarket) checkOrder(orderType string, amount decimal.Decimal, price decimal.Decimal) error {
+	if bm.info.Status != marketStatusTrading {
+		return newOrderRejectedError(bm.Name(), "market has status %s", bm.info.Status)
+	}
+	supported := len(bm.info.OrderTypes) == 0
+	for _, marketOrderType := range bm.info.OrderTypes {
+		if marketOrderType == orderType {
+			supported = true
+		}
+	}
+	if !supported {
+		return newOrderRejectedError(bm.Name(), "%s orders are not supported", orderType)
+	}
+	if minBase, err := decimal.NewFromString(bm.info.MinOrderInBaseAsset); err == nil && amount.LessThan(minBase) {
+		return newOrderRejectedError(bm.Name(), "amount %s is below the minimum of %s %s", amount, minBase, bm.From)
+	}
+	value := amount.Mul(price)
+	if minQuote, err := decimal.NewFromString(bm.info.MinOrderInQuoteAsset); err == nil && value.LessThan(minQuote) {
+		return newOrderRejectedError(bm.Name(), "value %s is below the minimum of %s %s", bm.roundQuote(value),
+			minQuote, bm.To)
+	}
+	if orderType != orderTypeMarket && !price.Equal(bm.roundPrice(price)) {
+		return newOrderRejectedError(bm.Name(), "price %s has more than %d significant digits", price,
+			bm.info.PricePrecision)
+	}
+	return nil
 }
 
 func (bm BvvMarket) GetExpectedRate() (total decimal.Decimal, err error) {
@@ -190,6 +242,45 @@ func (bm BvvMarket) Total() (total decimal.Decimal) {
 	return bm.Available.Add(bm.InOrder)
 }
 
+// fiatPrice returns the price of the base asset in fiat, which is the price itself for markets that are quoted in fiat
+func (bm BvvMarket) fiatPrice() (decimal.Decimal, error) {
+	return bm.handler.price(bm.From, bm.handler.config.Fiat)
+}
+
+// Projected returns the total as it will be when all open orders are filled
+func (bm BvvMarket) Projected() (total decimal.Decimal) {
+	return bm.Total().Add(bm.PendingBuy).Sub(bm.PendingSell)
+}
+
+// Pending returns the amount that is still in open orders for a side
+func (bm BvvMarket) Pending(side string) decimal.Decimal {
+	if side == "buy" {
+		return bm.PendingBuy
+	}
+	return bm.PendingSell
+}
+
+// setPending sums the remaining amounts of the open orders of this market
+func (bm *BvvMarket) setPending(orders []bitvavo.Order) error {
+	bm.PendingBuy, bm.PendingSell = decimal.Zero, decimal.Zero
+	for _, order := range orders {
+		if order.Market != bm.Name() || isProtective(order.OrderType) {
+			// stopLoss and takeProfit orders protect the position, they are not meant to change it
+			continue
+		}
+		remaining, err := decimal.NewFromString(order.AmountRemaining)
+		if err != nil {
+			return fmt.Errorf("could not convert amountRemaining to Decimal %s: %e", order.AmountRemaining, err)
+		}
+		if order.Side == "buy" {
+			bm.PendingBuy = bm.PendingBuy.Add(remaining)
+		} else {
+			bm.PendingSell = bm.PendingSell.Add(remaining)
+		}
+	}
+	return nil
+}
+
 func (bm BvvMarket) Name() (name string) {
 	return fmt.Sprintf("%s-%s", bm.From, bm.To)
 }
@@ -0,0 +1,17 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// TestNewBvvMarketInvalidEMA checks that a market with an invalid moving average is an error, instead of a market
+// that is silently left out
+func TestNewBvvMarketInvalidEMA(t *testing.T) {
+	config := BvvConfig{Markets: map[string]bvvMarketConfig{"BTC": {MAConfig: bvvMAConfig{Type: "emaa"}}}}
+	bh := newTestHandler(t, config, newFakeExchange(), map[string]string{"BTC-EUR": "30000"})
+	if _, err := NewBvvMarket(bh, "BTC", decimal.NewFromInt(1), decimal.Zero); err == nil {
+		t.Errorf("expected an error for ema type emaa")
+	}
+}
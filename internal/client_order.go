@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+// orderIntent is an order that is about to be placed, or was placed, in the current evaluation window
+type orderIntent struct {
+	Market    string `yaml:"market"`
+	Side      string `yaml:"side"`
+	OrderType string `yaml:"orderType"`
+	Slot      string `yaml:"slot,omitempty"`
+	Price     string `yaml:"price,omitempty"`
+	Window    int    `yaml:"window"`
+	OrderId   string `yaml:"orderId"`
+}
+
+// clientOrderId returns a UUID which is the same for every order of a market, side, order type and slot in a window.
+// The slot tells apart orders which are placed next to each other, like the levels of a grid.
+func clientOrderId(market string, side string, orderType string, slot string, window int) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%s/%d", market, side, orderType, slot, window)))
+	id := hash[:16]
+	// Version 5 (name based) and RFC 4122 variant
+	id[6] = id[6]&0x0f | 0x50
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// orderWindow returns the start (in ms) of the evaluation window we are in, according to the exchange
+func (bh BvvHandler) orderWindow() (start int, err error) {
+	window, err := time.ParseDuration(bh.config.OrderWindow)
+	if err != nil {
+		return 0, fmt.Errorf("invalid orderWindow %s: %e", bh.config.OrderWindow, err)
+	} else if window <= 0 {
+		return 0, fmt.Errorf("invalid orderWindow %s, should be positive", bh.config.OrderWindow)
+	}
+	now, err := bh.connection.Time()
+	if err != nil {
+		return 0, err
+	}
+	length := int(window / time.Millisecond)
+	return now.Time - now.Time%length, nil
+}
+
+// submitOrder places an order with a client order id, unless the order of this window was placed before.
+// The intent is saved before the order is placed, so when a run crashes or times out before the response is saved,
+// the next run looks up the order on the exchange instead of placing it twice.
+// It returns placed=false with the existing order when the order was already placed.
+func (bh BvvHandler) submitOrder(market string, side string, orderType string, slot string, body bvvOptions) (
+	order bitvavo.Order, placed bool, err error) {
+	window, err := bh.orderWindow()
+	if err != nil {
+		return order, false, err
+	}
+	for id, intent := range bh.state.Intents {
+		if intent.Window < window {
+			delete(bh.state.Intents, id)
+		}
+	}
+	id := clientOrderId(market, side, orderType, slot, window)
+	intent, exists := bh.state.Intents[id]
+	if !exists {
+		intent = orderIntent{Market: market, Side: side, OrderType: orderType, Slot: slot, Price: body["price"],
+			Window: window}
+	} else if intent.OrderId == "" {
+		// The last attempt did not return an order, but it might have reached the exchange anyway
+		if intent.OrderId, err = bh.findOrder(intent); err != nil {
+			return order, false, err
+		}
+	}
+	if intent.OrderId != "" {
+		order, err = bh.connection.GetOrder(market, intent.OrderId)
+		if err != nil && !isOrderNotFound(err) {
+			return order, false, fmt.Errorf("could not get order %s: %e", intent.OrderId, err)
+		} else if err == nil && (isOpen(order) || order.Status == "filled") {
+			log.Printf("%s order for %s was already placed in this window as %s (%s)", side, market,
+				intent.OrderId, order.Status)
+			bh.state.Intents[id] = intent
+			return order, false, bh.state.save()
+		}
+		// Canceled, expired or rejected orders may be placed again
+		intent.OrderId = ""
+	}
+	bh.state.Intents[id] = intent
+	if err = bh.state.save(); err != nil {
+		return order, false, err
+	}
+	body["clientOrderId"] = id
+	if order, err = bh.connection.PlaceOrder(market, side, orderType, body); err != nil {
+		return order, false, err
+	}
+	intent.OrderId = order.OrderId
+	bh.state.Intents[id] = intent
+	return order, true, bh.state.save()
+}
+
+// findOrder returns the id of an order on the exchange which matches an intent without an order id.
+// The Bitvavo client does not return the client order id, so orders are matched by side, order type and price.
+func (bh BvvHandler) findOrder(intent orderIntent) (orderId string, err error) {
+	orders, err := bh.connection.GetOrders(intent.Market, bvvOptions{"start": strconv.Itoa(intent.Window)})
+	if err != nil {
+		return "", fmt.Errorf("could not get orders of %s: %e", intent.Market, err)
+	}
+	known := make(map[string]bool)
+	for _, other := range bh.state.Intents {
+		known[other.OrderId] = true
+	}
+	for _, order := range orders {
+		if order.Side == intent.Side && order.OrderType == intent.OrderType && order.Created >= intent.Window &&
+			samePrice(order.Price, intent.Price) && !known[order.OrderId] {
+			log.Printf("Found %s order %s for %s which was placed in this window", intent.Side, order.OrderId,
+				intent.Market)
+			return order.OrderId, nil
+		}
+	}
+	return "", nil
+}
+
+// samePrice returns true when the price of an order equals the price of an intent, or the intent has no price
+func samePrice(orderPrice string, intentPrice string) bool {
+	if intentPrice == "" {
+		return true
+	}
+	price, err := decimal.NewFromString(orderPrice)
+	if err != nil {
+		return false
+	}
+	expected, err := decimal.NewFromString(intentPrice)
+	return err == nil && price.Equal(expected)
+}
@@ -1,10 +1,14 @@
 package internal
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/shopspring/decimal"
 	"gopkg.in/yaml.v2"
 )
 
@@ -18,31 +22,139 @@ import (
  */
 
 const (
-	envConfName     = "BVVCONFIG"
-	defaultConfFile = "./bvvconfig.yaml"
-	Fiat            = "EUR"
+	envConfName      = "BVVCONFIG"
+	defaultConfFile  = "./bvvconfig.yaml"
+	defaultRestUrl   = "https://api.bitvavo.com/v2"
+	defaultWsUrl     = "wss://ws.bitvavo.com/v2/"
+	defaultPaperFile = "./bvvpaper.yaml"
+	defaultStateFile = "./bvvstate.yaml"
+	Fiat             = "EUR"
 )
 
 type bvvApiConfig struct {
-	Key    string `yaml:"key"`
-	Secret string `yaml:"secret"`
-	Debug  bool   `yaml:"debug"`
+	Key     string `yaml:"key"`
+	Secret  string `yaml:"secret"`
+	Debug   bool   `yaml:"debug"`
+	RestUrl string `yaml:"restUrl"`
+	WsUrl   string `yaml:"wsUrl"`
 }
 
+func (api *bvvApiConfig) SetDefaults() {
+	if api.RestUrl == "" {
+		api.RestUrl = defaultRestUrl
+	}
+	if api.WsUrl == "" {
+		api.WsUrl = defaultWsUrl
+	}
+}
+
+const (
+	// maTypeLogSMA is a simple moving average of log(price) with an offset
+	maTypeLogSMA = "logsma"
+	// maTypeEMA is an exponentially weighted moving average
+	maTypeEMA = "ema"
+
+	orderTypeMarket     = "market"
+	orderTypeLimit      = "limit"
+	orderTypeStopLoss   = "stopLoss"
+	orderTypeTakeProfit = "takeProfit"
+	// What to do with limit orders that are still open on the next run
+	unfilledCancel  = "cancel"
+	unfilledReprice = "reprice"
+	unfilledKeep    = "keep"
+	// Most Bitvavo markets accept prices with at most 5 significant digits
+	defaultPricePrecision = 5
+	// Orders can only be placed on markets with this status
+	marketStatusTrading = "trading"
+	// How the fiat is shared when there is not enough for all buys
+	allocationPriority     = "priority"
+	allocationProportional = "proportional"
+	allocationUnderrated   = "underrated"
+	// The price that stopLoss and takeProfit orders are relative to
+	referenceRate = "rate"
+	referenceEMA  = "ema"
+	// Within this window, a market places at most one order per side and order type
+	defaultOrderWindow = "1h"
+	// Number of order book levels that are used to estimate the fill price of market orders
+	slippageBookDepth = 100
+	// DCA frequencies, next to cron expressions
+	dcaDaily  = "daily"
+	dcaWeekly = "weekly"
+	// The slot in the client order id of buys that include a dca amount
+	dcaSlot = "dca"
+	// Percentage points that the weight of a market can drift from its targetWeight
+	defaultTolerance = 2
+	// The window (in ms) of the daily risk limits, which is rolling
+	riskDayWindow = 24 * 60 * 60 * 1000
+)
+
 type bvvMAConfig struct {
+	Type     string `yaml:"type"`
 	Interval string `yaml:"interval"`
 	Window   int    `yaml:"window"`
 	Limit    int64  `yaml:"limit"`
+	// Smoothing is only used by type ema (alpha = smoothing / (1 + window)), defaults to 2
+	Smoothing float64 `yaml:"smoothing"`
+	// Indicators are reported per market and can be used by strategies, by name
+	Indicators map[string]bvvIndicatorConfig `yaml:"indicators"`
+}
+
+// bvvIndicatorConfig configures an indicator. Which options are used depends on the type.
+type bvvIndicatorConfig struct {
+	Type       string  `yaml:"type"`
+	Window     int     `yaml:"window"`
+	Smoothing  float64 `yaml:"smoothing"`
+	Fast       int     `yaml:"fast"`
+	Slow       int     `yaml:"slow"`
+	Signal     int     `yaml:"signal"`
+	Deviations float64 `yaml:"deviations"`
+}
+
+func (ic *bvvIndicatorConfig) SetDefaults() {
+	switch ic.Type {
+	case indicatorMACD:
+		if ic.Fast == 0 {
+			ic.Fast = 12
+		}
+		if ic.Slow == 0 {
+			ic.Slow = 26
+		}
+		if ic.Signal == 0 {
+			ic.Signal = 9
+		}
+	case indicatorRSI:
+		if ic.Window == 0 {
+			ic.Window = 14
+		}
+	case indicatorBollinger:
+		if ic.Window == 0 {
+			ic.Window = 20
+		}
+		if ic.Deviations == 0 {
+			ic.Deviations = 2
+		}
+	case indicatorATR:
+		if ic.Window == 0 {
+			ic.Window = 14
+		}
+	case indicatorVWAP:
+		if ic.Window == 0 {
+			ic.Window = 20
+		}
+	}
 }
 
 func (mac *bvvMAConfig) Enabled() bool {
-	if mac.Window > 0 || mac.Limit > 0 || mac.Interval != "" {
+	if mac.Window > 0 || mac.Limit > 0 || mac.Interval != "" || mac.Type != "" {
 		return true
 	}
 	return false
 }
 
 func (mac *bvvMAConfig) SetDefaults() {
+	if mac.Type == "" {
+		mac.Type = maTypeLogSMA
+	}
 	if mac.Interval == "" {
 		mac.Interval = "1d"
 	}
@@ -52,15 +164,152 @@ func (mac *bvvMAConfig) SetDefaults() {
 	if mac.Limit == 0 {
 		mac.Limit = 2 * int64(mac.Window)
 	}
+	indicators := make(map[string]bvvIndicatorConfig)
+	for name, ic := range mac.Indicators {
+		ic.SetDefaults()
+		indicators[name] = ic
+	}
+	mac.Indicators = indicators
+}
+
+type bvvPaperConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	StateFile string `yaml:"stateFile"`
+	// Fee is charged as a percentage of every filled order, and reported as the maker and taker fee of the account
+	Fee decimal.Decimal `yaml:"fee"`
+	// Balances to start with. When not set, the paper wallet starts with the balances of the real account
+	Balances map[string]decimal.Decimal `yaml:"balances"`
+}
+
+func (pc *bvvPaperConfig) SetDefaults() {
+	if pc.StateFile == "" {
+		pc.StateFile = defaultPaperFile
+	}
+}
+
+// bvvDeviationConfig configures the ema strategy. Percentages are relative to the expected rate, and amount is the
+// maximum order size in fiat.
+type bvvDeviationConfig struct {
+	BuyPercent  decimal.Decimal `yaml:"buyPercent"`
+	SellPercent decimal.Decimal `yaml:"sellPercent"`
+	Amount      decimal.Decimal `yaml:"amount"`
+}
+
+// bvvGridConfig configures the grid strategy, which keeps limit orders on levels that are evenly spread between low
+// and high. Amount is the amount of the symbol which is bought or sold on every level.
+type bvvGridConfig struct {
+	Low    decimal.Decimal `yaml:"low"`
+	High   decimal.Decimal `yaml:"high"`
+	Levels int             `yaml:"levels"`
+	Amount decimal.Decimal `yaml:"amount"`
+}
+
+// bvvProtectionConfig configures a stopLoss or takeProfit order that is maintained for a market
+type bvvProtectionConfig struct {
+	// Percent below (stopLoss) or above (takeProfit) the reference price
+	Percent decimal.Decimal `yaml:"percent"`
+	// Reference is rate (the average rate of our trades, default) or ema (the expected rate)
+	Reference string `yaml:"reference"`
+}
+
+func (pc bvvProtectionConfig) Enabled() bool {
+	return pc.Percent.GreaterThan(decimal.Zero)
+}
+
+func (pc *bvvProtectionConfig) SetDefaults() {
+	if pc.Reference == "" {
+		pc.Reference = referenceRate
+	}
+}
+
+// bvvTrailingStopConfig defers sells of the strategy until the price drops Percent below the highest price since the
+// strategy first wanted to sell
+type bvvTrailingStopConfig struct {
+	Percent decimal.Decimal `yaml:"percent"`
+}
+
+func (tsc bvvTrailingStopConfig) Enabled() bool {
+	return tsc.Percent.GreaterThan(decimal.Zero)
+}
+
+// bvvDCAConfig buys for a fixed amount of fiat every period. Frequency is daily (default), weekly or a cron
+// expression, in the local time of the host.
+type bvvDCAConfig struct {
+	Amount    decimal.Decimal `yaml:"amount"`
+	Frequency string          `yaml:"frequency"`
+	// Only buy while the price is below the expected rate
+	BelowEMA bool `yaml:"belowEma"`
+}
+
+func (dc bvvDCAConfig) Enabled() bool {
+	return dc.Amount.GreaterThan(decimal.Zero)
+}
+
+func (dc *bvvDCAConfig) SetDefaults() {
+	if dc.Frequency == "" {
+		dc.Frequency = dcaDaily
+	}
+}
+
+// bvvLimitsConfig caps the orders of the strategies. Values are in fiat, and limits that are not set are not checked.
+type bvvLimitsConfig struct {
+	MaxOrder decimal.Decimal `yaml:"maxOrder"`
+	MaxRun   decimal.Decimal `yaml:"maxRun"`
+	// MaxDay and MaxOrdersPerDay are over the last 24 hours
+	MaxDay          decimal.Decimal `yaml:"maxDay"`
+	MaxOrdersPerDay int             `yaml:"maxOrdersPerDay"`
 }
 
 type bvvMarketConfig struct {
 	// When more then this level of currency is available, we can sell
-	BuyUnderwater bool        `yaml:"buy_underwater"`
-	MinLevel      string      `yaml:"min"`
-	MaxLevel      string      `yaml:"max"`
-	RateWindow    int         `yaml:"rateWindow"`
-	MAConfig      bvvMAConfig `yaml:"ema"`
+	BuyUnderwater bool   `yaml:"buy_underwater"`
+	MinLevel      string `yaml:"min"`
+	MaxLevel      string `yaml:"max"`
+	// LevelAsset is the asset that min and max are expressed in, defaults to fiat
+	LevelAsset string      `yaml:"levelAsset"`
+	RateWindow int         `yaml:"rateWindow"`
+	MAConfig   bvvMAConfig `yaml:"ema"`
+	// Strategy decides which orders are placed, defaults to minmax
+	Strategy  string             `yaml:"strategy"`
+	Deviation bvvDeviationConfig `yaml:"deviation"`
+	Grid      bvvGridConfig      `yaml:"grid"`
+	// OrderType is market (default) or limit
+	OrderType string `yaml:"orderType"`
+	// LimitOffset is the percentage below the best bid (buy) or above the best ask (sell) for limit orders
+	LimitOffset decimal.Decimal `yaml:"limitOffset"`
+	// TimeInForce is GTC (default), IOC or FOK
+	TimeInForce string `yaml:"timeInForce"`
+	// Unfilled decides what happens with open limit orders on the next run: cancel (default), reprice or keep
+	Unfilled     string                `yaml:"unfilled"`
+	StopLoss     bvvProtectionConfig   `yaml:"stopLoss"`
+	TakeProfit   bvvProtectionConfig   `yaml:"takeProfit"`
+	TrailingStop bvvTrailingStopConfig `yaml:"trailingStop"`
+	// Markets with a higher priority are funded first when budgetAllocation is priority
+	Priority int `yaml:"priority"`
+	// Market orders are lowered (or skipped) when the estimated fill price is further than this from the price
+	MaxSlippagePercent decimal.Decimal `yaml:"maxSlippagePercent"`
+	DCA                bvvDCAConfig    `yaml:"dca"`
+	// TargetWeight is the percentage of the portfolio for the weight strategy, which rebalances the market when its
+	// weight is more than tolerance (in percentage points) away
+	TargetWeight decimal.Decimal `yaml:"targetWeight"`
+	Tolerance    decimal.Decimal `yaml:"tolerance"`
+	// Limits of this market, which are checked next to the limits of all markets together
+	Limits bvvLimitsConfig `yaml:"limits"`
+}
+
+func (mc *bvvMarketConfig) SetDefaults() {
+	if mc.OrderType == "" {
+		mc.OrderType = orderTypeMarket
+	}
+	if mc.Unfilled == "" {
+		mc.Unfilled = unfilledCancel
+	}
+	mc.StopLoss.SetDefaults()
+	mc.TakeProfit.SetDefaults()
+	mc.DCA.SetDefaults()
+	if mc.TargetWeight.GreaterThan(decimal.Zero) && mc.Tolerance.Equal(decimal.Zero) {
+		mc.Tolerance = decimal.NewFromInt(defaultTolerance)
+	}
 }
 
 type BvvConfig struct {
@@ -69,7 +318,35 @@ type BvvConfig struct {
 	Fiat          string                     `yaml:"fiat"`
 	Markets       map[string]bvvMarketConfig `yaml:"markets"`
 	ActiveMode    bool                       `yaml:"activeMode"`
+	PaperTrading  bvvPaperConfig             `yaml:"paperTrading"`
+	StateFile     string                     `yaml:"stateFile"`
 	Debug         bool                       `yaml:"debug"`
+
+	// BudgetAllocation is priority (default), proportional or underrated
+	BudgetAllocation string `yaml:"budgetAllocation"`
+	// OrderWindow (e.g. 15m or 1h) is the window in which a market places at most one order per side and order type
+	OrderWindow string `yaml:"orderWindow"`
+	// Limits of all markets together
+	Limits bvvLimitsConfig `yaml:"limits"`
+}
+
+// PaperMode returns true when orders should be filled by a simulated wallet instead of the real account
+func (c BvvConfig) PaperMode() bool {
+	return !c.ActiveMode && c.PaperTrading.Enabled
+}
+
+// placeOrders returns false when we should only log which orders we would place
+func (c BvvConfig) placeOrders() bool {
+	return c.ActiveMode || c.PaperMode()
+}
+
+// marketName returns the market of a key in markets. A key is a symbol, which is traded against fiat, or a market
+// like ETH-BTC.
+func (c BvvConfig) marketName(key string) string {
+	if strings.Contains(key, "-") {
+		return key
+	}
+	return fmt.Sprintf("%s-%s", key, c.Fiat)
 }
 
 func NewConfig() (config BvvConfig, err error) {
@@ -92,5 +369,67 @@ func NewConfig() (config BvvConfig, err error) {
 	if config.Fiat == "" {
 		config.Fiat = Fiat
 	}
+	if config.StateFile == "" {
+		config.StateFile = defaultStateFile
+	}
+	if config.PaperMode() {
+		// Orders, intents, traded volume and the like of the paper wallet should not end up in live runs
+		config.StateFile = paperStateFile(config.StateFile)
+	}
+	if config.BudgetAllocation == "" {
+		config.BudgetAllocation = allocationPriority
+	}
+	if config.OrderWindow == "" {
+		config.OrderWindow = defaultOrderWindow
+	}
+	config.Api.SetDefaults()
+	config.PaperTrading.SetDefaults()
+	for name, marketConfig := range config.Markets {
+		marketConfig.SetDefaults()
+		config.Markets[name] = marketConfig
+	}
+	if err == nil {
+		err = config.validate()
+	}
 	return config, err
 }
+
+// paperStateFile returns the state file that is used instead of file in paper mode (e.g. bvvstate.paper.yaml for
+// bvvstate.yaml)
+func paperStateFile(file string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + ".paper" + ext
+}
+
+// validate returns an error for settings that can only be checked when the markets are created, so a mistake in
+// the config is reported when it is read, instead of leaving a market out of trading
+func (c BvvConfig) validate() error {
+	var keys []string
+	for key := range c.Markets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	// Every market trades the balance of its base asset, so two markets with the same base would trade against each
+	// other
+	bases := make(map[string]string)
+	for _, key := range keys {
+		name := c.marketName(key)
+		base, _, err := splitMarket(name)
+		if err != nil {
+			return err
+		}
+		if other, exists := bases[base]; exists {
+			return fmt.Errorf("markets %s and %s both trade the %s balance, only one market per asset is supported",
+				other, name, base)
+		}
+		bases[base] = name
+		maConfig := c.Markets[key].MAConfig
+		if !maConfig.Enabled() && len(maConfig.Indicators) == 0 {
+			continue
+		}
+		if err := validateMAConfig(maConfig); err != nil {
+			return fmt.Errorf("invalid ema config for market %s: %e", c.marketName(key), err)
+		}
+	}
+	return nil
+}
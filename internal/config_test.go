@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestConfigValidate(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		markets map[string]bvvMarketConfig
+		valid   bool
+	}{
+		{name: "no ema", markets: map[string]bvvMarketConfig{"BTC": {}}, valid: true},
+		{name: "logsma", markets: map[string]bvvMarketConfig{"BTC": {MAConfig: bvvMAConfig{Window: 20}}},
+			valid: true},
+		{name: "ema", markets: map[string]bvvMarketConfig{"BTC": {MAConfig: bvvMAConfig{Type: maTypeEMA}}},
+			valid: true},
+		{name: "unknown ema type", markets: map[string]bvvMarketConfig{"BTC": {MAConfig: bvvMAConfig{Type: "emaa"}}}},
+		{name: "indicator", markets: map[string]bvvMarketConfig{"BTC": {MAConfig: bvvMAConfig{
+			Indicators: map[string]bvvIndicatorConfig{"rsi": {Type: indicatorRSI, Window: 14}},
+		}}}, valid: true},
+		{name: "crypto quote", markets: map[string]bvvMarketConfig{"BTC": {}, "DOT-BTC": {}}, valid: true},
+		{name: "same base", markets: map[string]bvvMarketConfig{"ETH": {}, "ETH-BTC": {}}},
+		{name: "same market", markets: map[string]bvvMarketConfig{"BTC": {}, "BTC-EUR": {}}},
+		{name: "unknown indicator", markets: map[string]bvvMarketConfig{"BTC": {MAConfig: bvvMAConfig{
+			Indicators: map[string]bvvIndicatorConfig{"rsi": {Type: "rsii", Window: 14}},
+		}}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := BvvConfig{Fiat: "EUR", Markets: test.markets}
+			if err := config.validate(); (err == nil) != test.valid {
+				t.Errorf("expected valid to be %t, got %v", test.valid, err)
+			}
+		})
+	}
+}
+
+// TestExampleConfig checks that the example config can be read
+func TestExampleConfig(t *testing.T) {
+	previous, set := os.LookupEnv(envConfName)
+	if err := os.Setenv(envConfName, filepath.Join("..", "bvvconfig.yaml.example")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if set {
+			_ = os.Setenv(envConfName, previous)
+		} else {
+			_ = os.Unsetenv(envConfName)
+		}
+	}()
+	config, err := NewConfig()
+	if err != nil {
+		t.Fatalf("could not read example config: %v", err)
+	}
+	if len(config.Markets) == 0 || !config.Limits.MaxOrder.GreaterThan(decimal.Zero) {
+		t.Errorf("expected markets and limits in the example config, got %v", config)
+	}
+}
+
+func TestPaperStateFile(t *testing.T) {
+	for file, expected := range map[string]string{
+		"./bvvstate.yaml":      "./bvvstate.paper.yaml",
+		"/var/lib/bvv/state":   "/var/lib/bvv/state.paper",
+		"state.v2.yml":         "state.v2.paper.yml",
+		"./bvv.d/bvvstate.yml": "./bvv.d/bvvstate.paper.yml",
+	} {
+		if paperFile := paperStateFile(file); paperFile != expected {
+			t.Errorf("expected %s for %s, got %s", expected, file, paperFile)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression with the fields minute, hour, day of month, month and day of week
+type cronSchedule struct {
+	minute     map[int]bool
+	hour       map[int]bool
+	dayOfMonth map[int]bool
+	month      map[int]bool
+	dayOfWeek  map[int]bool
+	// Like cron does, a day matches either field when both day of month and day of week are restricted
+	anyDay bool
+}
+
+// cronFieldRanges are the lowest and highest value of every field
+var cronFieldRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// parseCron parses a cron expression like `30 8 * * 1-5`. Fields can be *, a value, a range, a list and a step.
+func parseCron(expression string) (schedule cronSchedule, err error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("cron expression %s should have 5 fields", expression)
+	}
+	var parsed [5]map[int]bool
+	for i, field := range fields {
+		if parsed[i], err = parseCronField(field, cronFieldRanges[i][0], cronFieldRanges[i][1]); err != nil {
+			return schedule, fmt.Errorf("invalid cron expression %s: %e", expression, err)
+		}
+	}
+	// Both 0 and 7 are sunday
+	if parsed[4][7] {
+		parsed[4][0] = true
+	}
+	return cronSchedule{
+		minute:     parsed[0],
+		hour:       parsed[1],
+		dayOfMonth: parsed[2],
+		month:      parsed[3],
+		dayOfWeek:  parsed[4],
+		anyDay:     fields[2] != "*" && fields[4] != "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (values map[int]bool, err error) {
+	values = make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %s", part)
+			}
+			part = part[:i]
+		}
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value in %s", part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value in %s", part)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%s is out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func (cs cronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth, dayOfWeek := cs.dayOfMonth[t.Day()], cs.dayOfWeek[int(t.Weekday())]
+	if cs.anyDay {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
+
+// previous returns the last time at or before t where the schedule fires, looking back at most 5 years
+func (cs cronSchedule) previous(t time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+	limit := t.AddDate(-5, 0, 0)
+	for t.After(limit) {
+		switch {
+		case !cs.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !cs.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !cs.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !cs.minute[t.Minute()]:
+			t = t.Add(-time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return t, false
+}
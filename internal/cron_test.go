@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	for _, test := range []struct {
+		field    string
+		expected []int
+		invalid  bool
+	}{
+		{field: "*", expected: []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{field: "3", expected: []int{3}},
+		{field: "1-3", expected: []int{1, 2, 3}},
+		{field: "1,4,6", expected: []int{1, 4, 6}},
+		{field: "*/3", expected: []int{0, 3, 6}},
+		{field: "2/2", expected: []int{2, 4, 6}},
+		{field: "1-5/2", expected: []int{1, 3, 5}},
+		{field: "0,5-6", expected: []int{0, 5, 6}},
+		{field: "8", invalid: true},
+		{field: "5-2", invalid: true},
+		{field: "*/0", invalid: true},
+		{field: "a", invalid: true},
+		{field: "1-b", invalid: true},
+	} {
+		values, err := parseCronField(test.field, 0, 7)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.field, values)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: could not parse: %v", test.field, err)
+			continue
+		}
+		if len(values) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.field, test.expected, values)
+		}
+		for _, value := range test.expected {
+			if !values[value] {
+				t.Errorf("%s: expected %d in %v", test.field, value, values)
+			}
+		}
+	}
+}
+
+func TestCronPrevious(t *testing.T) {
+	// Wednesday 17 March 2021 12:34:56
+	now := time.Date(2021, 3, 17, 12, 34, 56, 0, time.UTC)
+	for _, test := range []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"* * * * *", time.Date(2021, 3, 17, 12, 34, 0, 0, time.UTC)},
+		{"30 * * * *", time.Date(2021, 3, 17, 12, 30, 0, 0, time.UTC)},
+		{"45 * * * *", time.Date(2021, 3, 17, 11, 45, 0, 0, time.UTC)},
+		{"30 8 * * 1-5", time.Date(2021, 3, 17, 8, 30, 0, 0, time.UTC)},
+		{"0 13 * * *", time.Date(2021, 3, 16, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 12 *", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)},
+		// With both day fields restricted, either one matches
+		{"0 0 1 * 1", time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+	} {
+		schedule, err := parseCron(test.expression)
+		if err != nil {
+			t.Fatalf("%s: could not parse: %v", test.expression, err)
+		}
+		if previous, found := schedule.previous(now); !found || !previous.Equal(test.expected) {
+			t.Errorf("%s: expected %s, got %s (found: %t)", test.expression, test.expected, previous, found)
+		}
+	}
+	schedule, err := parseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous, found := schedule.previous(now); found {
+		t.Errorf("expected 31 February never to fire, got %s", previous)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8"} {
+		if _, err := parseCron(expression); err == nil {
+			t.Errorf("expected %q to be invalid", expression)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// dcaSchedule returns the schedule of a dca frequency
+func dcaSchedule(frequency string) (cronSchedule, error) {
+	switch frequency {
+	case dcaDaily:
+		return parseCron("0 0 * * *")
+	case dcaWeekly:
+		return parseCron("0 0 * * 1")
+	}
+	return parseCron(frequency)
+}
+
+// addDCA adds the dca buy of a market to the orders of the strategy, when it did not run yet in this period.
+// The dca amount is added to a buy of the strategy, and skipped when the strategy wants to sell.
+func (bh BvvHandler) addDCA(market BvvMarket, orders []PlannedOrder) ([]PlannedOrder, error) {
+	config := market.config.DCA
+	if !config.Enabled() {
+		return orders, nil
+	}
+	schedule, err := dcaSchedule(config.Frequency)
+	if err != nil {
+		return orders, fmt.Errorf("invalid dca frequency: %e", err)
+	}
+	now, err := bh.connection.Time()
+	if err != nil {
+		return orders, err
+	}
+	period, found := schedule.previous(time.Unix(0, int64(now.Time)*int64(time.Millisecond)))
+	if !found || bh.state.DCA[market.Name()] >= int(period.UnixNano()/int64(time.Millisecond)) {
+		return orders, nil
+	}
+	if config.BelowEMA {
+		expectedRate, err := market.GetExpectedRate()
+		if err != nil {
+			return orders, err
+		}
+		if market.Price.GreaterThanOrEqual(expectedRate) {
+			log.Printf("%s: not buying dca, price %s is not below the expected rate %s", market.Name(),
+				market.Price, expectedRate.Round(5))
+			return orders, nil
+		}
+	}
+	price, err := market.fiatPrice()
+	if err != nil {
+		return orders, err
+	}
+	amount := config.Amount.Div(price)
+	if market.Max.GreaterThan(decimal.Zero) {
+		// Everything above max would be sold again
+		amount = decimal.Min(amount, market.Max.Sub(market.Projected()))
+	}
+	if !amount.GreaterThan(decimal.Zero) {
+		log.Printf("%s: not buying dca, already at max", market.Name())
+		return orders, nil
+	}
+	for i, order := range orders {
+		switch order.Side {
+		case "sell":
+			log.Printf("%s: not buying dca, strategy wants to sell", market.Name())
+			return orders, nil
+		case "buy":
+			orders[i].Amount = order.Amount.Add(amount)
+			orders[i].Reason = fmt.Sprintf("%s, dca %s", order.Reason, config.Frequency)
+			orders[i].DCA = true
+			return orders, nil
+		}
+	}
+	return append(orders, PlannedOrder{Side: "buy", Amount: amount, Reason: fmt.Sprintf("dca %s", config.Frequency),
+		DCA: true}), nil
+}
+
+// buyDCA places a buy which includes the dca amount of a market. It has its own slot in the client order id, so it is
+// not mistaken for another buy of the market in this window. The period is only done when the order is on the exchange.
+func (bh BvvHandler) buyDCA(market BvvMarket, amount decimal.Decimal) error {
+	onExchange, err := bh.placeOrder(market, "buy", amount, dcaSlot)
+	if err != nil || !onExchange {
+		return err
+	}
+	return bh.recordDCA(market)
+}
+
+// recordDCA saves that the dca buy of a market was placed in this period
+func (bh BvvHandler) recordDCA(market BvvMarket) error {
+	now, err := bh.connection.Time()
+	if err != nil {
+		return err
+	}
+	bh.state.DCA[market.Name()] = now.Time
+	return bh.state.save()
+}
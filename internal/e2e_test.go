@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sebasmannem/bvvmoneymaker/pkg/bvv_mock"
+)
+
+// TestEvaluateAgainstMock runs Evaluate against bvv_mock with the fixtures in testdata/mock, and checks which orders
+// where posted
+func TestEvaluateAgainstMock(t *testing.T) {
+	mock := bvv_mock.NewServer(filepath.Join("..", "testdata", "mock"), "mockkey", "mocksecret")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	previous, set := os.LookupEnv(envConfName)
+	if err := os.Setenv(envConfName, filepath.Join("..", "testdata", "mock", "bvvconfig.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if set {
+			_ = os.Setenv(envConfName, previous)
+		} else {
+			_ = os.Unsetenv(envConfName)
+		}
+	}()
+	config, err := NewConfig()
+	if err != nil {
+		t.Fatalf("could not read config: %v", err)
+	}
+	config.Api.RestUrl = server.URL + "/v2"
+	config.Api.WsUrl = strings.Replace(server.URL, "http", "ws", 1) + "/v2/"
+	config.StateFile = filepath.Join(t.TempDir(), "bvvstate.yaml")
+
+	bh, err := NewBvvHandler(config, NewBitvavoExchange(config.Api))
+	if err != nil {
+		t.Fatalf("could not create handler: %v", err)
+	}
+	if err = bh.Evaluate(); err != nil {
+		t.Fatalf("could not evaluate: %v", err)
+	}
+
+	expected := []bvv_mock.PostedOrder{
+		{"market": "BTC-EUR", "side": "sell", "orderType": "limit", "amount": "0.0005", "price": "30040"},
+		{"market": "DOT-BTC", "side": "sell", "orderType": "market", "amount": "0.66666667"},
+		{"market": "ETH-EUR", "side": "buy", "orderType": "limit", "amount": "0.0075", "price": "1999"},
+		{"market": "ADA-EUR", "side": "sell", "orderType": "stopLoss", "amount": "100", "triggerAmount": "0.44378"},
+	}
+	posted := mock.Orders()
+	if len(posted) != len(expected) {
+		t.Fatalf("expected %d orders, but %d where posted: %v", len(expected), len(posted), posted)
+	}
+	for i, order := range expected {
+		for key, value := range order {
+			if posted[i][key] != value {
+				t.Errorf("order %d: expected %s %s, got %s (%v)", i, key, value, posted[i][key], posted[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/bitvavo/go-bitvavo-api"
+)
+
+// Exchange holds all calls the BvvHandler makes to an exchange.
+// *bitvavo.Bitvavo implements it, but fakes, recorders and simulators can be used as well.
+type Exchange interface {
+	Time() (bitvavo.Time, error)
+	GetRemainingLimit() int
+	Assets(options map[string]string) ([]bitvavo.Assets, error)
+	Markets(options map[string]string) ([]bitvavo.Markets, error)
+	TickerPrice(options map[string]string) ([]bitvavo.TickerPrice, error)
+	TickerBook(options map[string]string) ([]bitvavo.TickerBook, error)
+	Book(market string, options map[string]string) (bitvavo.Book, error)
+	Candles(market string, interval string, options map[string]string) ([]bitvavo.Candle, error)
+	Balance(options map[string]string) ([]bitvavo.Balance, error)
+	Account() (bitvavo.Account, error)
+	Trades(market string, options map[string]string) ([]bitvavo.Trades, error)
+	PlaceOrder(market string, side string, orderType string, body map[string]string) (bitvavo.Order, error)
+	UpdateOrder(market string, orderId string, body map[string]string) (bitvavo.Order, error)
+	CancelOrder(market string, orderId string) (bitvavo.CancelOrder, error)
+	CancelOrders(options map[string]string) ([]bitvavo.CancelOrder, error)
+	OrdersOpen(options map[string]string) ([]bitvavo.Order, error)
+	GetOrder(market string, orderId string) (bitvavo.Order, error)
+	GetOrders(market string, options map[string]string) ([]bitvavo.Order, error)
+}
+
+// errorCodeOrderNotFound is returned by Bitvavo for orders that do not exist (anymore)
+const errorCodeOrderNotFound = 240
+
+func newOrderNotFoundError(orderId string) error {
+	return bitvavo.MyError{CustomError: bitvavo.CustomError{
+		Code:    errorCodeOrderNotFound,
+		Message: fmt.Sprintf("No order found with id %s.", orderId),
+	}}
+}
+
+func isOrderNotFound(err error) bool {
+	var apiError bitvavo.MyError
+	return errors.As(err, &apiError) && apiError.CustomError.Code == errorCodeOrderNotFound
+}
+
+// NewBitvavoExchange returns a connection to the Bitvavo API (or a stand-in when restUrl is configured)
+func NewBitvavoExchange(config bvvApiConfig) Exchange {
+	return &bitvavo.Bitvavo{
+		ApiKey:       config.Key,
+		ApiSecret:    config.Secret,
+		RestUrl:      config.RestUrl,
+		WsUrl:        config.WsUrl,
+		AccessWindow: 10000,
+		Debugging:    config.Debug,
+	}
+}
+
+// NewExchange returns the Exchange as configured, which is a PaperExchange in paper trading mode
+func NewExchange(config BvvConfig) (Exchange, error) {
+	connection := NewBitvavoExchange(config.Api)
+	if config.PaperMode() {
+		log.Printf("Paper trading with wallet from %s", config.PaperTrading.StateFile)
+		return NewPaperExchange(connection, config.PaperTrading)
+	}
+	return connection, nil
+}
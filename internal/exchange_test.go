@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+// fakeExchange keeps orders in memory, and records what is done with them. Methods that a test does not need are not
+// implemented, and panic through the nil Exchange.
+type fakeExchange struct {
+	Exchange
+	now      int
+	orders   map[string]bitvavo.Order
+	placed   []bitvavo.Order
+	updated  []bitvavo.Order
+	canceled []string
+	book     bitvavo.Book
+}
+
+func newFakeExchange() *fakeExchange {
+	return &fakeExchange{now: 1600000000000, orders: make(map[string]bitvavo.Order)}
+}
+
+// addOrder adds an order which was placed before the test started
+func (fe *fakeExchange) addOrder(order bitvavo.Order) {
+	fe.orders[order.OrderId] = order
+}
+
+func (fe *fakeExchange) Time() (bitvavo.Time, error) {
+	return bitvavo.Time{Time: fe.now}, nil
+}
+
+func (fe *fakeExchange) Trades(market string, options map[string]string) ([]bitvavo.Trades, error) {
+	return nil, nil
+}
+
+func (fe *fakeExchange) Book(market string, options map[string]string) (bitvavo.Book, error) {
+	return fe.book, nil
+}
+
+func (fe *fakeExchange) PlaceOrder(market string, side string, orderType string, body map[string]string) (
+	bitvavo.Order, error) {
+	order := bitvavo.Order{
+		OrderId:       fmt.Sprintf("fake-%d", len(fe.orders)+1),
+		Market:        market,
+		Created:       fe.now,
+		Status:        "new",
+		Side:          side,
+		OrderType:     orderType,
+		Amount:        body["amount"],
+		Price:         body["price"],
+		TriggerAmount: body["triggerAmount"],
+	}
+	fe.orders[order.OrderId] = order
+	fe.placed = append(fe.placed, order)
+	return order, nil
+}
+
+func (fe *fakeExchange) UpdateOrder(market string, orderId string, body map[string]string) (bitvavo.Order, error) {
+	order, exists := fe.orders[orderId]
+	if !exists || order.Market != market {
+		return order, newOrderNotFoundError(orderId)
+	}
+	if amount, set := body["amount"]; set {
+		order.Amount = amount
+	}
+	if trigger, set := body["triggerAmount"]; set {
+		order.TriggerAmount = trigger
+	}
+	fe.orders[orderId] = order
+	fe.updated = append(fe.updated, order)
+	return order, nil
+}
+
+func (fe *fakeExchange) CancelOrder(market string, orderId string) (bitvavo.CancelOrder, error) {
+	order, exists := fe.orders[orderId]
+	if !exists || order.Market != market {
+		return bitvavo.CancelOrder{}, newOrderNotFoundError(orderId)
+	}
+	order.Status = "canceled"
+	fe.orders[orderId] = order
+	fe.canceled = append(fe.canceled, orderId)
+	return bitvavo.CancelOrder{OrderId: orderId}, nil
+}
+
+func (fe *fakeExchange) GetOrder(market string, orderId string) (bitvavo.Order, error) {
+	order, exists := fe.orders[orderId]
+	if !exists || order.Market != market {
+		return order, newOrderNotFoundError(orderId)
+	}
+	return order, nil
+}
+
+func (fe *fakeExchange) GetOrders(market string, options map[string]string) (orders []bitvavo.Order, err error) {
+	for _, order := range fe.orders {
+		if order.Market == market {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// newTestHandler returns a handler with an in memory state, which trades markets against EUR on a fakeExchange.
+// Every market of the config gets a price, and the assets have 8 decimals.
+func newTestHandler(t *testing.T, config BvvConfig, exchange *fakeExchange, prices map[string]string) *BvvHandler {
+	t.Helper()
+	if config.Fiat == "" {
+		config.Fiat = "EUR"
+	}
+	if config.OrderWindow == "" {
+		config.OrderWindow = "1h"
+	}
+	state, err := loadState("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bh := &BvvHandler{
+		connection: exchange,
+		config:     config,
+		prices:     make(map[string]decimal.Decimal),
+		assets:     map[string]bitvavo.Assets{config.Fiat: {Symbol: config.Fiat, Decimals: 2}},
+		marketInfo: make(map[string]bitvavo.Markets),
+		state:      state,
+		balances:   make(map[string]assetBalance),
+		runStart:   exchange.now,
+	}
+	for name, price := range prices {
+		base, quote, err := splitMarket(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bh.prices[name] = decimal.RequireFromString(price)
+		bh.assets[base] = bitvavo.Assets{Symbol: base, Decimals: 8}
+		bh.marketInfo[name] = bitvavo.Markets{Status: marketStatusTrading, Base: base, Quote: quote, Market: name,
+			PricePrecision: 5, MinOrderInQuoteAsset: "5", MinOrderInBaseAsset: "0.0001"}
+	}
+	return bh
+}
+
+// newTestMarket returns a market of a test handler with a balance of the base asset
+func newTestMarket(t *testing.T, bh *BvvHandler, key string, available string) BvvMarket {
+	t.Helper()
+	base, quote, err := splitMarket(bh.config.marketName(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return BvvMarket{
+		From:      base,
+		To:        quote,
+		handler:   bh,
+		config:    bh.config.Markets[key],
+		Available: decimal.RequireFromString(available),
+		Price:     bh.prices[base+"-"+quote],
+		info:      bh.marketInfo[base+"-"+quote],
+	}
+}
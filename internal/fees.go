@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// tradingFees are the fees of the account, as a fraction of the value of a trade
+type tradingFees struct {
+	Maker decimal.Decimal
+	Taker decimal.Decimal
+}
+
+// GetFees reads the maker and taker fee of the fee tier of the account
+func (bh *BvvHandler) GetFees() (err error) {
+	account, err := bh.connection.Account()
+	if err != nil {
+		return fmt.Errorf("could not get account: %e", err)
+	}
+	if bh.fees.Maker, err = decimal.NewFromString(account.Fees.Maker); err != nil {
+		return fmt.Errorf("could not convert maker fee to Decimal %s: %e", account.Fees.Maker, err)
+	}
+	if bh.fees.Taker, err = decimal.NewFromString(account.Fees.Taker); err != nil {
+		return fmt.Errorf("could not convert taker fee to Decimal %s: %e", account.Fees.Taker, err)
+	}
+	return nil
+}
+
+// feeRate returns the fee we expect to pay for the configured order type of this market. Limit orders are expected
+// to add to the order book and pay the maker fee, all other orders pay the taker fee.
+func (bm BvvMarket) feeRate() decimal.Decimal {
+	if bm.handler == nil {
+		return decimal.Zero
+	}
+	if bm.config.OrderType == orderTypeLimit {
+		return bm.handler.fees.Maker
+	}
+	return bm.handler.fees.Taker
+}
+
+// buyPrice returns what buying one unit costs, including the fee
+func (bm BvvMarket) buyPrice() decimal.Decimal {
+	return bm.Price.Mul(decimal.NewFromInt(1).Add(bm.feeRate()))
+}
+
+// sellPrice returns what selling one unit yields, after the fee
+func (bm BvvMarket) sellPrice() decimal.Decimal {
+	return bm.Price.Mul(decimal.NewFromInt(1).Sub(bm.feeRate()))
+}
+
+// describeOrder returns the value, the fee and the net result of a planned order
+func (bm BvvMarket) describeOrder(order PlannedOrder) string {
+	value := order.Amount.Mul(bm.Price)
+	fee := value.Mul(bm.feeRate())
+	if order.Side == "buy" {
+		return fmt.Sprintf("costs %s %s, including %s %s fee", bm.roundQuote(value.Add(fee)), bm.To,
+			bm.roundQuote(fee), bm.To)
+	}
+	description := fmt.Sprintf("yields %s %s, after %s %s fee", bm.roundQuote(value.Sub(fee)), bm.To,
+		bm.roundQuote(fee), bm.To)
+	if avgRate, err := bm.rate.Average(); err == nil {
+		result := value.Sub(fee).Sub(order.Amount.Mul(avgRate))
+		description += fmt.Sprintf(", net result %s %s", bm.roundQuote(result), bm.To)
+	}
+	return description
+}
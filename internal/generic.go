@@ -29,3 +29,18 @@ func decimalPercent(amount decimal.Decimal, scale decimal.Decimal) decimal.Decim
 	//return hundred.Sub(hundred.Mul(amount.Sub(scale).Div(amount))).Round(2)
 	return hundred.Mul(amount.Sub(scale).Div(amount)).Round(2)
 }
+
+// roundSignificant rounds a value to a number of significant digits, like Bitvavo requires for prices
+func roundSignificant(value decimal.Decimal, digits int32) decimal.Decimal {
+	if value.Equal(decimal.Zero) {
+		return value
+	}
+	// value = coefficient * 10^exponent, so this is the position of the most significant digit
+	intDigits := int32(len(value.Abs().Coefficient().String())) + value.Exponent()
+	return value.Round(digits - intDigits)
+}
+
+// roundUp rounds a value up to a number of decimal places
+func roundUp(value decimal.Decimal, places int32) decimal.Decimal {
+	return value.Shift(places).Ceil().Shift(-places)
+}
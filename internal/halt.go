@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Halt stops all trading until Resume is called. The halted flag is saved before the open orders of all configured
+// markets are canceled, so trading stays halted even when canceling fails.
+func (bh BvvHandler) Halt() error {
+	bh.state.Halted = true
+	if err := bh.state.save(); err != nil {
+		return fmt.Errorf("could not save halted state: %e", err)
+	}
+	log.Printf("Trading is halted")
+	var markets []string
+	for key := range bh.config.Markets {
+		markets = append(markets, bh.config.marketName(key))
+	}
+	sort.Strings(markets)
+	for _, market := range markets {
+		canceled, err := bh.connection.CancelOrders(bvvOptions{"market": market})
+		if err != nil {
+			return fmt.Errorf("could not cancel orders of market %s: %e", market, err)
+		}
+		for _, order := range canceled {
+			log.Printf("Canceled order %s for %s", order.OrderId, market)
+		}
+	}
+	return nil
+}
+
+// Resume clears the halted flag, so the next evaluation places orders again
+func (bh BvvHandler) Resume() error {
+	if !bh.state.Halted {
+		log.Printf("Trading is not halted")
+		return nil
+	}
+	bh.state.Halted = false
+	log.Printf("Trading is resumed")
+	return bh.state.save()
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/sebasmannem/bvvmoneymaker/pkg/moving_average"
+)
+
+const (
+	indicatorSMA       = "sma"
+	indicatorLogSMA    = maTypeLogSMA
+	indicatorEMA       = maTypeEMA
+	indicatorRSI       = "rsi"
+	indicatorMACD      = "macd"
+	indicatorBollinger = "bollinger"
+	indicatorVWAP      = "vwap"
+	indicatorATR       = "atr"
+	indicatorOBV       = "obv"
+)
+
+// newIndicator returns an indicator as configured. New indicators only need to be added here.
+func newIndicator(config bvvIndicatorConfig) (moving_average.Indicator, error) {
+	switch config.Type {
+	case indicatorSMA:
+		sma, err := moving_average.NewSimpleMovingAverage(config.Window)
+		return &sma, err
+	case indicatorLogSMA:
+		return moving_average.NewEMA(config.Window)
+	case indicatorEMA:
+		return moving_average.NewExponentialMovingAverage(config.Window, config.Smoothing)
+	case indicatorRSI:
+		return moving_average.NewRSI(config.Window)
+	case indicatorMACD:
+		return moving_average.NewMACD(config.Fast, config.Slow, config.Signal)
+	case indicatorBollinger:
+		return moving_average.NewBollingerBands(config.Window, config.Deviations)
+	case indicatorVWAP:
+		return moving_average.NewVWAP(config.Window)
+	case indicatorATR:
+		return moving_average.NewATR(config.Window)
+	case indicatorOBV:
+		return moving_average.NewOBV(), nil
+	default:
+		return nil, fmt.Errorf("unknown indicator type %s", config.Type)
+	}
+}
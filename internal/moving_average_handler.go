@@ -21,24 +21,56 @@ type MABucket struct {
 }
 
 type MAHandler struct {
-	market   *BvvMarket
-	interval string
-	limit    int64
-	buckets  MABuckets
-	ema      *moving_average.EMA
+	market     *BvvMarket
+	interval   string
+	limit      int64
+	buckets    MABuckets
+	ema        moving_average.MovingAverage
+	indicators map[string]moving_average.Indicator
+}
+
+func newMovingAverage(config bvvMAConfig) (moving_average.MovingAverage, error) {
+	switch config.Type {
+	case maTypeLogSMA:
+		return moving_average.NewEMA(config.Window)
+	case maTypeEMA:
+		return moving_average.NewExponentialMovingAverage(config.Window, config.Smoothing)
+	default:
+		return nil, fmt.Errorf("unknown moving average type %s", config.Type)
+	}
+}
+
+// validateMAConfig returns an error when the moving average or one of the indicators of a config cannot be created
+func validateMAConfig(config bvvMAConfig) error {
+	config.SetDefaults()
+	if _, err := newMovingAverage(config); err != nil {
+		return err
+	}
+	for name, indicatorConfig := range config.Indicators {
+		if _, err := newIndicator(indicatorConfig); err != nil {
+			return fmt.Errorf("invalid indicator %s: %e", name, err)
+		}
+	}
+	return nil
 }
 
 func NewMAHandler(market *BvvMarket, config bvvMAConfig) (mah *MAHandler, err error) {
 	config.SetDefaults()
-	ema, err := moving_average.NewEMA(config.Window)
+	ema, err := newMovingAverage(config)
 	if err != nil {
 		return mah, err
 	}
 	mah = &MAHandler{
-		market:   market,
-		interval: config.Interval,
-		limit:    config.Limit,
-		ema:      ema,
+		market:     market,
+		interval:   config.Interval,
+		limit:      config.Limit,
+		ema:        ema,
+		indicators: make(map[string]moving_average.Indicator),
+	}
+	for name, indicatorConfig := range config.Indicators {
+		if mah.indicators[name], err = newIndicator(indicatorConfig); err != nil {
+			return nil, fmt.Errorf("invalid indicator %s: %e", name, err)
+		}
 	}
 	err = mah.initFromCandles()
 	if err != nil {
@@ -83,6 +115,16 @@ func (mab MABucket) Average() (avg decimal.Decimal) {
 	return mab.low.Add(mab.open).Add(mab.close).Add(mab.high).Div(decimal.NewFromInt(4))
 }
 
+func (mab MABucket) Candle() moving_average.Candle {
+	return moving_average.Candle{
+		Open:   mab.open,
+		High:   mab.high,
+		Low:    mab.low,
+		Close:  mab.close,
+		Volume: mab.volume,
+	}
+}
+
 // Some helper functions to sort candles by timestamp
 type candlesByTS []bitvavo.Candle
 
@@ -97,6 +139,7 @@ func (mah *MAHandler) initFromCandles() (err error) {
 	if candlesErr != nil {
 		return candlesErr
 	} else {
+		mah.reset()
 		// Sort the candles by Timestamp before processing
 		sort.Sort(candlesByTS(candlesResponse))
 		for _, candle := range candlesResponse {
@@ -108,7 +151,86 @@ func (mah *MAHandler) initFromCandles() (err error) {
 			// Storing this last value for .GetOverrated() too
 			mah.buckets = append(mah.buckets, bucket)
 			mah.ema.AddValue(bucket.Average())
+			mah.addIndicatorBucket(bucket)
 		}
 	}
 	return nil
 }
+
+// reset clears the buckets, the moving average and all indicators, so they can be initialized again
+func (mah *MAHandler) reset() {
+	mah.buckets = nil
+	mah.ema.Reset()
+	for _, indicator := range mah.indicators {
+		indicator.Reset()
+	}
+}
+
+// addIndicatorBucket feeds a bucket into all indicators. Indicators which only use one value get the close,
+// like charting sites do.
+func (mah *MAHandler) addIndicatorBucket(bucket MABucket) {
+	for _, indicator := range mah.indicators {
+		if candleIndicator, ok := indicator.(moving_average.CandleIndicator); ok {
+			candleIndicator.AddCandle(bucket.Candle())
+		} else {
+			indicator.AddValue(bucket.close)
+		}
+	}
+}
+
+// IndicatorNames returns the names of all configured indicators, sorted
+func (mah MAHandler) IndicatorNames() (names []string) {
+	for name := range mah.indicators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (mah MAHandler) GetIndicator(name string) (indicator moving_average.Indicator, err error) {
+	indicator, exists := mah.indicators[name]
+	if !exists {
+		return nil, fmt.Errorf("indicator %s is not configured for market %s", name, mah.market.Name())
+	}
+	return indicator, nil
+}
+
+// GetRSI returns the value of the first (by name) RSI indicator
+func (mah MAHandler) GetRSI() (rsi decimal.Decimal, err error) {
+	for _, name := range mah.IndicatorNames() {
+		if indicator, ok := mah.indicators[name].(*moving_average.RSI); ok {
+			return indicator.Get()
+		}
+	}
+	return rsi, fmt.Errorf("rsi is not configured for market %s", mah.market.Name())
+}
+
+// GetMACD returns the value of the first (by name) MACD indicator
+func (mah MAHandler) GetMACD() (macd moving_average.MACDValue, err error) {
+	for _, name := range mah.IndicatorNames() {
+		if indicator, ok := mah.indicators[name].(*moving_average.MACD); ok {
+			return indicator.Get()
+		}
+	}
+	return macd, fmt.Errorf("macd is not configured for market %s", mah.market.Name())
+}
+
+// GetBollingerBands returns the value of the first (by name) Bollinger Bands indicator
+func (mah MAHandler) GetBollingerBands() (bb moving_average.BollingerValue, err error) {
+	for _, name := range mah.IndicatorNames() {
+		if indicator, ok := mah.indicators[name].(*moving_average.BollingerBands); ok {
+			return indicator.Get()
+		}
+	}
+	return bb, fmt.Errorf("bollinger is not configured for market %s", mah.market.Name())
+}
+
+// GetATRPercent returns the value of the first (by name) ATR indicator as a percentage of the current price
+func (mah MAHandler) GetATRPercent() (percent decimal.Decimal, err error) {
+	for _, name := range mah.IndicatorNames() {
+		if indicator, ok := mah.indicators[name].(*moving_average.ATR); ok {
+			return indicator.GetPercent(mah.market.Price)
+		}
+	}
+	return percent, fmt.Errorf("atr is not configured for market %s", mah.market.Name())
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+// trackedOrder is the last known state of an order that was placed by bvv_moneymaker
+type trackedOrder struct {
+	Market       string          `yaml:"market"`
+	Side         string          `yaml:"side"`
+	OrderType    string          `yaml:"orderType"`
+	Status       string          `yaml:"status"`
+	Amount       decimal.Decimal `yaml:"amount"`
+	FilledAmount decimal.Decimal `yaml:"filledAmount"`
+	Created      int             `yaml:"created"`
+	Updated      int             `yaml:"updated"`
+}
+
+// trackOrder saves a placed order in the state, so it can be followed up on later runs
+func (bh BvvHandler) trackOrder(order bitvavo.Order) error {
+	amount, err := decimal.NewFromString(order.Amount)
+	if err != nil {
+		return fmt.Errorf("could not convert amount of order %s to Decimal %s: %e", order.OrderId, order.Amount, err)
+	}
+	bh.state.Orders[order.OrderId] = trackedOrder{
+		Market:    order.Market,
+		Side:      order.Side,
+		OrderType: order.OrderType,
+		Status:    "new",
+		Amount:    amount,
+		Created:   order.Created,
+	}
+	if err = bh.updateTrackedOrder(order.OrderId, order); err != nil {
+		return err
+	}
+	return bh.state.save()
+}
+
+// updateTrackedOrders polls all tracked orders of a market and records fills, partial fills and cancellations.
+// It returns all open orders of the market, including the ones that where not placed by us.
+func (bh BvvHandler) updateTrackedOrders(market BvvMarket) (open []bitvavo.Order, err error) {
+	open, err = bh.connection.OrdersOpen(bvvOptions{"market": market.Name()})
+	if err != nil {
+		return nil, err
+	}
+	openById := make(map[string]bitvavo.Order)
+	for _, order := range open {
+		openById[order.OrderId] = order
+	}
+	var orderIds []string
+	for orderId, tracked := range bh.state.Orders {
+		if tracked.Market == market.Name() {
+			orderIds = append(orderIds, orderId)
+		}
+	}
+	sort.Strings(orderIds)
+	for _, orderId := range orderIds {
+		order, found := openById[orderId]
+		if !found {
+			if order, err = bh.connection.GetOrder(market.Name(), orderId); isOrderNotFound(err) {
+				log.Printf("Order %s for %s does not exist anymore, no longer tracking it", orderId, market.Name())
+				delete(bh.state.Orders, orderId)
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("could not get order %s: %e", orderId, err)
+			}
+		}
+		if err = bh.updateTrackedOrder(orderId, order); err != nil {
+			return nil, err
+		}
+	}
+	return open, bh.state.save()
+}
+
+// updateTrackedOrder logs what changed since the last known state of an order.
+// Orders are no longer tracked once they are filled, canceled or otherwise done, and only what was filled of them
+// counts for the risk limits.
+func (bh BvvHandler) updateTrackedOrder(orderId string, order bitvavo.Order) error {
+	tracked := bh.state.Orders[orderId]
+	filled := tracked.FilledAmount
+	if order.FilledAmount != "" {
+		var err error
+		if filled, err = decimal.NewFromString(order.FilledAmount); err != nil {
+			return fmt.Errorf("could not convert filledAmount of order %s to Decimal %s: %e", orderId,
+				order.FilledAmount, err)
+		}
+	}
+	if isOpen(order) {
+		if filled.GreaterThan(tracked.FilledAmount) {
+			log.Printf("%s order %s for %s is partially filled: %s of %s", tracked.Side, orderId, tracked.Market,
+				filled, tracked.Amount)
+		}
+		tracked.Status = order.Status
+		tracked.FilledAmount = filled
+		tracked.Updated = order.Updated
+		bh.state.Orders[orderId] = tracked
+		return nil
+	}
+	if order.Status == "filled" {
+		log.Printf("%s order %s for %s is filled: %s", tracked.Side, orderId, tracked.Market, filled)
+	} else {
+		log.Printf("%s order %s for %s is %s after filling %s of %s", tracked.Side, orderId, tracked.Market,
+			order.Status, filled, tracked.Amount)
+		bh.releaseVolume(orderId, filled, tracked.Amount)
+	}
+	delete(bh.state.Orders, orderId)
+	return nil
+}
@@ -0,0 +1,574 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v2"
+)
+
+// paperWallet holds the virtual balances and the trades of a paper trading account
+type paperWallet struct {
+	Balances  map[string]decimal.Decimal `yaml:"balances"`
+	InOrder   map[string]decimal.Decimal `yaml:"inOrder"`
+	Orders    []bitvavo.Order            `yaml:"orders"`
+	Trades    []bitvavo.Trades           `yaml:"trades"`
+	LastOrder int                        `yaml:"lastOrder"`
+}
+
+// PaperExchange is an Exchange that reads market data from another Exchange,
+// but keeps balances, orders and trades in a local wallet and fills orders itself.
+type PaperExchange struct {
+	market    Exchange
+	config    bvvPaperConfig
+	wallet    paperWallet
+	stateFile string
+}
+
+func NewPaperExchange(market Exchange, config bvvPaperConfig) (pe *PaperExchange, err error) {
+	pe = &PaperExchange{
+		market:    market,
+		config:    config,
+		stateFile: config.StateFile,
+	}
+	if err = pe.load(); err != nil {
+		return nil, err
+	}
+	return pe, nil
+}
+
+// newMemoryPaperExchange returns a PaperExchange which starts with balances, and never saves its wallet
+func newMemoryPaperExchange(market Exchange, config bvvPaperConfig,
+	balances map[string]decimal.Decimal) *PaperExchange {
+	pe := &PaperExchange{
+		market: market,
+		config: config,
+		wallet: paperWallet{Balances: make(map[string]decimal.Decimal)},
+	}
+	for symbol, balance := range balances {
+		pe.wallet.Balances[symbol] = balance
+	}
+	return pe
+}
+
+func (pe *PaperExchange) load() (err error) {
+	// The state file is configured by the operator
+	// #nosec
+	yamlState, err := ioutil.ReadFile(pe.stateFile)
+	if os.IsNotExist(err) {
+		log.Printf("Initializing paper wallet in %s", pe.stateFile)
+		return pe.initWallet()
+	} else if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(yamlState, &pe.wallet)
+}
+
+// initWallet uses the configured balances, or the balances of the real account when none are configured
+func (pe *PaperExchange) initWallet() (err error) {
+	pe.wallet = paperWallet{Balances: make(map[string]decimal.Decimal)}
+	if len(pe.config.Balances) > 0 {
+		for symbol, balance := range pe.config.Balances {
+			pe.wallet.Balances[symbol] = balance
+		}
+		return pe.save()
+	}
+	balanceResponse, err := pe.market.Balance(bvvOptions{})
+	if err != nil {
+		return err
+	}
+	for _, b := range balanceResponse {
+		balance, err := decimal.NewFromString(b.Available)
+		if err != nil {
+			return fmt.Errorf("could not convert available to Decimal %s: %e", b.Available, err)
+		}
+		pe.wallet.Balances[b.Symbol] = balance
+	}
+	return pe.save()
+}
+
+func (pe *PaperExchange) save() error {
+	if pe.stateFile == "" {
+		return nil
+	}
+	yamlState, err := yaml.Marshal(pe.wallet)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(pe.stateFile, yamlState)
+}
+
+// Balances returns a copy of the current virtual balances
+func (pe *PaperExchange) Balances() map[string]decimal.Decimal {
+	balances := make(map[string]decimal.Decimal)
+	for symbol, balance := range pe.wallet.Balances {
+		balances[symbol] = balance
+	}
+	return balances
+}
+
+func (pe *PaperExchange) Time() (bitvavo.Time, error) {
+	return pe.market.Time()
+}
+
+func (pe *PaperExchange) GetRemainingLimit() int {
+	return pe.market.GetRemainingLimit()
+}
+
+func (pe *PaperExchange) Assets(options map[string]string) ([]bitvavo.Assets, error) {
+	return pe.market.Assets(options)
+}
+
+func (pe *PaperExchange) Markets(options map[string]string) ([]bitvavo.Markets, error) {
+	return pe.market.Markets(options)
+}
+
+func (pe *PaperExchange) TickerPrice(options map[string]string) ([]bitvavo.TickerPrice, error) {
+	return pe.market.TickerPrice(options)
+}
+
+func (pe *PaperExchange) Candles(market string, interval string, options map[string]string) ([]bitvavo.Candle, error) {
+	return pe.market.Candles(market, interval, options)
+}
+
+func (pe *PaperExchange) TickerBook(options map[string]string) ([]bitvavo.TickerBook, error) {
+	return pe.market.TickerBook(options)
+}
+
+func (pe *PaperExchange) Book(market string, options map[string]string) (bitvavo.Book, error) {
+	return pe.market.Book(market, options)
+}
+
+func (pe *PaperExchange) Balance(options map[string]string) (balances []bitvavo.Balance, err error) {
+	pe.matchOrders()
+	var symbols []string
+	for symbol := range pe.wallet.Balances {
+		if options["symbol"] == "" || options["symbol"] == symbol {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		balances = append(balances, bitvavo.Balance{
+			Symbol:    symbol,
+			Available: pe.wallet.Balances[symbol].String(),
+			InOrder:   pe.wallet.InOrder[symbol].String(),
+		})
+	}
+	return balances, nil
+}
+
+// Account returns the configured fee as both the maker and the taker fee
+func (pe *PaperExchange) Account() (bitvavo.Account, error) {
+	fee := pe.config.Fee.Div(decimal.NewFromInt(100)).String()
+	return bitvavo.Account{Fees: bitvavo.FeeObject{Maker: fee, Taker: fee, Volume: "0"}}, nil
+}
+
+func (pe *PaperExchange) Trades(market string, options map[string]string) (trades []bitvavo.Trades, err error) {
+	pe.matchOrders()
+	// Newest first, like Bitvavo does
+	for i := len(pe.wallet.Trades) - 1; i >= 0; i-- {
+		if pe.wallet.Trades[i].Market == market {
+			trades = append(trades, pe.wallet.Trades[i])
+		}
+	}
+	if limit, err := strconv.Atoi(options["limit"]); err == nil && limit < len(trades) {
+		trades = trades[:limit]
+	}
+	return trades, nil
+}
+
+func (pe *PaperExchange) price(market string) (price decimal.Decimal, err error) {
+	tickerPriceResponse, err := pe.market.TickerPrice(bvvOptions{"market": market})
+	if err != nil {
+		return price, err
+	}
+	for _, tickerPrice := range tickerPriceResponse {
+		if tickerPrice.Market == market {
+			return decimal.NewFromString(tickerPrice.Price)
+		}
+	}
+	return price, fmt.Errorf("could not find price for market %s", market)
+}
+
+func splitMarket(market string) (base string, quote string, err error) {
+	symbols := strings.SplitN(market, "-", 2)
+	if len(symbols) != 2 {
+		return "", "", fmt.Errorf("invalid market %s", market)
+	}
+	return symbols[0], symbols[1], nil
+}
+
+func (pe *PaperExchange) fee(amountQuote decimal.Decimal) decimal.Decimal {
+	return amountQuote.Mul(pe.config.Fee).Div(decimal.NewFromInt(100))
+}
+
+// PlaceOrder fills market orders at the current TickerPrice and charges the configured fee.
+// Limit orders are filled when the TickerPrice crosses the limit price, stopLoss and takeProfit orders are filled at
+// the TickerPrice once it crosses the triggerAmount. Until then the funds are held in order.
+func (pe *PaperExchange) PlaceOrder(market string, side string, orderType string,
+	body map[string]string) (order bitvavo.Order, err error) {
+	pe.matchOrders()
+	if side != "buy" && side != "sell" {
+		return order, fmt.Errorf("invalid side %s", side)
+	}
+	current, err := pe.price(market)
+	if err != nil {
+		return order, err
+	}
+	price := current
+	status := "new"
+	switch orderType {
+	case orderTypeMarket:
+	case orderTypeLimit:
+		if price, err = decimal.NewFromString(body["price"]); err != nil {
+			return order, fmt.Errorf("limit order requires a valid price: %e", err)
+		}
+	case orderTypeStopLoss, orderTypeTakeProfit:
+		if price, err = decimal.NewFromString(body["triggerAmount"]); err != nil {
+			return order, fmt.Errorf("%s order requires a valid triggerAmount: %e", orderType, err)
+		}
+		status = "awaitingTrigger"
+	default:
+		return order, fmt.Errorf("paper trading does not support %s orders", orderType)
+	}
+	var amount decimal.Decimal
+	if body["amount"] != "" {
+		if amount, err = decimal.NewFromString(body["amount"]); err != nil {
+			return order, err
+		}
+	} else if body["amountQuote"] != "" {
+		amountQuote, err := decimal.NewFromString(body["amountQuote"])
+		if err != nil {
+			return order, err
+		}
+		amount = amountQuote.Div(price)
+	}
+	if !amount.GreaterThan(decimal.Zero) {
+		return order, fmt.Errorf("cannot place an order without an amount")
+	}
+
+	pe.wallet.LastOrder++
+	now := pe.now()
+	order = bitvavo.Order{
+		OrderId:          fmt.Sprintf("paper-%d", pe.wallet.LastOrder),
+		Market:           market,
+		Created:          now,
+		Updated:          now,
+		Status:           status,
+		Side:             side,
+		OrderType:        orderType,
+		Amount:           amount.String(),
+		AmountRemaining:  amount.String(),
+		Price:            body["price"],
+		TimeInForce:      body["timeInForce"],
+		TriggerAmount:    body["triggerAmount"],
+		TriggerPrice:     body["triggerAmount"],
+		TriggerType:      body["triggerType"],
+		TriggerReference: body["triggerReference"],
+	}
+	if fillable(order, price, current) {
+		err = pe.settle(&order, current, true)
+	} else if order.TimeInForce == "IOC" || order.TimeInForce == "FOK" {
+		order.Status = "canceled"
+	} else {
+		err = pe.lock(&order)
+	}
+	if err != nil {
+		return bitvavo.Order{}, err
+	}
+	pe.wallet.Orders = append(pe.wallet.Orders, order)
+	return order, pe.save()
+}
+
+// settle fills an order at a price, from the available balances
+func (pe *PaperExchange) settle(order *bitvavo.Order, price decimal.Decimal, taker bool) error {
+	base, quote, err := splitMarket(order.Market)
+	if err != nil {
+		return err
+	}
+	amount, err := decimal.NewFromString(order.AmountRemaining)
+	if err != nil {
+		return err
+	}
+	amountQuote := amount.Mul(price)
+	fee := pe.fee(amountQuote)
+	if order.Side == "buy" {
+		if pe.wallet.Balances[quote].LessThan(amountQuote.Add(fee)) {
+			return fmt.Errorf("insufficient balance: %s %s available, %s needed",
+				pe.wallet.Balances[quote], quote, amountQuote.Add(fee))
+		}
+		pe.wallet.Balances[quote] = pe.wallet.Balances[quote].Sub(amountQuote).Sub(fee)
+		pe.wallet.Balances[base] = pe.wallet.Balances[base].Add(amount)
+	} else {
+		if pe.wallet.Balances[base].LessThan(amount) {
+			return fmt.Errorf("insufficient balance: %s %s available, %s needed",
+				pe.wallet.Balances[base], base, amount)
+		}
+		pe.wallet.Balances[base] = pe.wallet.Balances[base].Sub(amount)
+		pe.wallet.Balances[quote] = pe.wallet.Balances[quote].Add(amountQuote).Sub(fee)
+	}
+	now := pe.now()
+	fill := bitvavo.Fill{
+		Id:          fmt.Sprintf("%s-%d", order.OrderId, len(order.Fills)+1),
+		Timestamp:   now,
+		Amount:      amount.String(),
+		Price:       price.String(),
+		Taker:       taker,
+		Fee:         fee.String(),
+		FeeCurrency: quote,
+		Settled:     true,
+	}
+	pe.wallet.Trades = append(pe.wallet.Trades, bitvavo.Trades{
+		Id:          fill.Id,
+		Timestamp:   now,
+		Market:      order.Market,
+		Amount:      fill.Amount,
+		Side:        order.Side,
+		Price:       fill.Price,
+		Taker:       taker,
+		Fee:         fill.Fee,
+		FeeCurrency: quote,
+		Settled:     true,
+	})
+	order.Fills = append(order.Fills, fill)
+	order.Status = "filled"
+	order.Updated = now
+	order.AmountRemaining = "0"
+	order.FilledAmount = amount.String()
+	order.FilledAmountQuote = amountQuote.String()
+	order.FeePaid = fee.String()
+	order.FeeCurrency = quote
+	return nil
+}
+
+// lock moves the funds of an open limit order from available to in order
+func (pe *PaperExchange) lock(order *bitvavo.Order) error {
+	base, quote, err := splitMarket(order.Market)
+	if err != nil {
+		return err
+	}
+	amount, err := decimal.NewFromString(order.AmountRemaining)
+	if err != nil {
+		return err
+	}
+	symbol, onHold := base, amount
+	if order.Side == "buy" {
+		price, err := orderPrice(*order)
+		if err != nil {
+			return err
+		}
+		symbol, onHold = quote, amount.Mul(price)
+		onHold = onHold.Add(pe.fee(onHold))
+	}
+	if pe.wallet.Balances[symbol].LessThan(onHold) {
+		return fmt.Errorf("insufficient balance: %s %s available, %s needed",
+			pe.wallet.Balances[symbol], symbol, onHold)
+	}
+	if pe.wallet.InOrder == nil {
+		pe.wallet.InOrder = make(map[string]decimal.Decimal)
+	}
+	pe.wallet.Balances[symbol] = pe.wallet.Balances[symbol].Sub(onHold)
+	pe.wallet.InOrder[symbol] = pe.wallet.InOrder[symbol].Add(onHold)
+	order.OnHold = onHold.String()
+	order.OnHoldCurrency = symbol
+	return nil
+}
+
+// unlock moves the funds of an open limit order back to available
+func (pe *PaperExchange) unlock(order *bitvavo.Order) {
+	onHold, err := decimal.NewFromString(order.OnHold)
+	if err != nil || order.OnHoldCurrency == "" {
+		return
+	}
+	pe.wallet.InOrder[order.OnHoldCurrency] = pe.wallet.InOrder[order.OnHoldCurrency].Sub(onHold)
+	pe.wallet.Balances[order.OnHoldCurrency] = pe.wallet.Balances[order.OnHoldCurrency].Add(onHold)
+	order.OnHold = "0"
+}
+
+func isOpen(order bitvavo.Order) bool {
+	return order.Status == "new" || order.Status == "partiallyFilled" || order.Status == "awaitingTrigger"
+}
+
+// orderPrice returns the limit price of a limit order, or the trigger amount of a stopLoss or takeProfit order
+func orderPrice(order bitvavo.Order) (decimal.Decimal, error) {
+	if isProtective(order.OrderType) {
+		return decimal.NewFromString(order.TriggerAmount)
+	}
+	return decimal.NewFromString(order.Price)
+}
+
+// fillable returns true when an order with a limit price or trigger amount should be filled at the current price
+func fillable(order bitvavo.Order, price decimal.Decimal, current decimal.Decimal) bool {
+	switch order.OrderType {
+	case orderTypeMarket:
+		return true
+	case orderTypeStopLoss:
+		// A stop loss sells when the price drops, or buys when it rises
+		return (order.Side == "sell" && current.LessThanOrEqual(price)) ||
+			(order.Side == "buy" && current.GreaterThanOrEqual(price))
+	default:
+		// Limit orders and take profit orders buy when the price drops, or sell when it rises
+		return (order.Side == "buy" && current.LessThanOrEqual(price)) ||
+			(order.Side == "sell" && current.GreaterThanOrEqual(price))
+	}
+}
+
+// matchOrders fills all open orders where the TickerPrice crossed the limit price or the trigger amount
+func (pe *PaperExchange) matchOrders() {
+	var changed bool
+	for i := range pe.wallet.Orders {
+		order := &pe.wallet.Orders[i]
+		if !isOpen(*order) {
+			continue
+		}
+		current, err := pe.price(order.Market)
+		if err != nil {
+			continue
+		}
+		price, err := orderPrice(*order)
+		if err != nil || !fillable(*order, price, current) {
+			continue
+		}
+		pe.unlock(order)
+		// Triggered orders are market orders, limit orders are filled at their price
+		taker := isProtective(order.OrderType)
+		if taker {
+			price = current
+		}
+		if err = pe.settle(order, price, taker); err != nil {
+			log.Printf("Paper order %s could not be filled: %e", order.OrderId, err)
+			_ = pe.lock(order)
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		if err := pe.save(); err != nil {
+			log.Printf("Error saving paper wallet: %e", err)
+		}
+	}
+}
+
+// openOrder returns a pointer to an open order, so it can be changed
+func (pe *PaperExchange) openOrder(market string, orderId string) (*bitvavo.Order, error) {
+	for i := range pe.wallet.Orders {
+		order := &pe.wallet.Orders[i]
+		if order.Market == market && order.OrderId == orderId {
+			if !isOpen(*order) {
+				return nil, fmt.Errorf("order %s is %s", orderId, order.Status)
+			}
+			return order, nil
+		}
+	}
+	return nil, newOrderNotFoundError(orderId)
+}
+
+func (pe *PaperExchange) OrdersOpen(options map[string]string) (orders []bitvavo.Order, err error) {
+	pe.matchOrders()
+	for _, order := range pe.wallet.Orders {
+		if isOpen(order) && (options["market"] == "" || options["market"] == order.Market) {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (pe *PaperExchange) GetOrder(market string, orderId string) (order bitvavo.Order, err error) {
+	pe.matchOrders()
+	for _, order := range pe.wallet.Orders {
+		if order.Market == market && order.OrderId == orderId {
+			return order, nil
+		}
+	}
+	return order, newOrderNotFoundError(orderId)
+}
+
+// GetOrders returns the orders of a market, newest first. The start option (in ms) skips older orders.
+func (pe *PaperExchange) GetOrders(market string, options map[string]string) (orders []bitvavo.Order, err error) {
+	pe.matchOrders()
+	start, _ := strconv.Atoi(options["start"])
+	for i := len(pe.wallet.Orders) - 1; i >= 0; i-- {
+		order := pe.wallet.Orders[i]
+		if order.Market == market && order.Created >= start {
+			orders = append(orders, order)
+		}
+	}
+	if limit, err := strconv.Atoi(options["limit"]); err == nil && limit < len(orders) {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+func (pe *PaperExchange) CancelOrder(market string, orderId string) (cancel bitvavo.CancelOrder, err error) {
+	order, err := pe.openOrder(market, orderId)
+	if err != nil {
+		return cancel, err
+	}
+	pe.unlock(order)
+	order.Status = "canceled"
+	order.Updated = pe.now()
+	return bitvavo.CancelOrder{OrderId: orderId}, pe.save()
+}
+
+// CancelOrders cancels all open orders, or all open orders of the market option
+func (pe *PaperExchange) CancelOrders(options map[string]string) (cancels []bitvavo.CancelOrder, err error) {
+	pe.matchOrders()
+	for i := range pe.wallet.Orders {
+		order := &pe.wallet.Orders[i]
+		if !isOpen(*order) || (options["market"] != "" && options["market"] != order.Market) {
+			continue
+		}
+		pe.unlock(order)
+		order.Status = "canceled"
+		order.Updated = pe.now()
+		cancels = append(cancels, bitvavo.CancelOrder{OrderId: order.OrderId})
+	}
+	return cancels, pe.save()
+}
+
+// UpdateOrder can change the price, the triggerAmount and the amount of an open order
+func (pe *PaperExchange) UpdateOrder(market string, orderId string, body map[string]string) (bitvavo.Order, error) {
+	order, err := pe.openOrder(market, orderId)
+	if err != nil {
+		return bitvavo.Order{}, err
+	}
+	previous := *order
+	pe.unlock(order)
+	if body["price"] != "" {
+		order.Price = body["price"]
+	}
+	if body["triggerAmount"] != "" {
+		order.TriggerAmount = body["triggerAmount"]
+		order.TriggerPrice = body["triggerAmount"]
+	}
+	if body["amount"] != "" {
+		order.Amount = body["amount"]
+		order.AmountRemaining = body["amount"]
+	}
+	if err = pe.lock(order); err != nil {
+		*order = previous
+		_ = pe.lock(order)
+		return bitvavo.Order{}, err
+	}
+	order.Updated = pe.now()
+	updated := *order
+	pe.matchOrders()
+	return updated, pe.save()
+}
+
+// now returns the exchange time, so simulations can run with their own clock
+func (pe *PaperExchange) now() int {
+	if t, err := pe.market.Time(); err == nil {
+		return t.Time
+	}
+	return int(time.Now().UnixNano() / int64(time.Millisecond))
+}
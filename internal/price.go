@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// directPrice returns the price of base in quote from the market itself, or from the reverse market
+func directPrice(prices map[string]decimal.Decimal, base string, quote string) (decimal.Decimal, bool) {
+	if base == quote {
+		return decimal.NewFromInt(1), true
+	}
+	if price, found := prices[fmt.Sprintf("%s-%s", base, quote)]; found {
+		return price, true
+	}
+	if price, found := prices[fmt.Sprintf("%s-%s", quote, base)]; found && price.GreaterThan(decimal.Zero) {
+		return decimal.NewFromInt(1).Div(price), true
+	}
+	return decimal.Zero, false
+}
+
+// resolvePrice returns the price of base in quote. When there is no market between them, the price is triangulated
+// through an asset that both have a market with (e.g. ETH-EUR and BTC-EUR for ETH-BTC).
+func resolvePrice(prices map[string]decimal.Decimal, base string, quote string) (decimal.Decimal, error) {
+	if price, found := directPrice(prices, base, quote); found {
+		return price, nil
+	}
+	var via []string
+	for name := range prices {
+		if from, to, err := splitMarket(name); err != nil {
+			continue
+		} else if from == base {
+			via = append(via, to)
+		} else if to == base {
+			via = append(via, from)
+		}
+	}
+	sort.Strings(via)
+	for _, asset := range via {
+		first, found := directPrice(prices, base, asset)
+		if !found {
+			continue
+		}
+		if second, found := directPrice(prices, asset, quote); found {
+			return first.Mul(second), nil
+		}
+	}
+	return decimal.Zero, fmt.Errorf("could not find a price for %s in %s", base, quote)
+}
+
+// price returns the current price of base in quote
+func (bh BvvHandler) price(base string, quote string) (decimal.Decimal, error) {
+	return resolvePrice(bh.prices, base, quote)
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+// protectivePlacement is a stopLoss or takeProfit order which is about to be placed
+type protectivePlacement struct {
+	amount  decimal.Decimal
+	trigger decimal.Decimal
+}
+
+// isProtective returns true for order types which are only executed when the price crosses a trigger amount
+func isProtective(orderType string) bool {
+	return orderType == orderTypeStopLoss || orderType == orderTypeTakeProfit
+}
+
+// protectionConfigs returns the stopLoss and takeProfit config of a market by order type
+func protectionConfigs(config bvvMarketConfig) map[string]bvvProtectionConfig {
+	return map[string]bvvProtectionConfig{
+		orderTypeStopLoss:   config.StopLoss,
+		orderTypeTakeProfit: config.TakeProfit,
+	}
+}
+
+// protectiveOrder returns the stopLoss or takeProfit order of a market, if it is still open
+func (bh BvvHandler) protectiveOrder(market BvvMarket, orderType string) (order bitvavo.Order, found bool,
+	err error) {
+	orderId, exists := bh.state.Protection[market.Name()][orderType]
+	if !exists {
+		return order, false, nil
+	}
+	order, err = bh.connection.GetOrder(market.Name(), orderId)
+	if err == nil && isOpen(order) {
+		return order, true, nil
+	} else if err != nil && !isOrderNotFound(err) {
+		return order, false, fmt.Errorf("could not get %s order %s: %e", orderType, orderId, err)
+	} else if err == nil {
+		log.Printf("%s order %s for %s is %s", orderType, orderId, market.Name(), order.Status)
+	}
+	delete(bh.state.Protection[market.Name()], orderType)
+	return order, false, bh.state.save()
+}
+
+// protectionTrigger returns the price where a stopLoss or takeProfit order should be triggered
+func (bh BvvHandler) protectionTrigger(market BvvMarket, orderType string,
+	config bvvProtectionConfig) (trigger decimal.Decimal, err error) {
+	var reference decimal.Decimal
+	switch config.Reference {
+	case referenceRate:
+		reference, err = market.rate.Average()
+	case referenceEMA:
+		reference, err = market.GetExpectedRate()
+	default:
+		return trigger, fmt.Errorf("invalid %s reference %s", orderType, config.Reference)
+	}
+	if err != nil {
+		return trigger, err
+	}
+	offset := config.Percent.Div(decimal.NewFromInt(100))
+	if orderType == orderTypeStopLoss {
+		trigger = reference.Mul(decimal.NewFromInt(1).Sub(offset))
+	} else {
+		// The profit is taken after the taker fee of the sell
+		trigger = reference.Mul(decimal.NewFromInt(1).Add(offset)).Div(decimal.NewFromInt(1).Sub(bh.fees.Taker))
+	}
+	return market.roundPrice(trigger), nil
+}
+
+// cancelProtection cancels the stopLoss and takeProfit orders of a market, so the funds they hold can be sold
+func (bh BvvHandler) cancelProtection(market BvvMarket) error {
+	for orderType, orderId := range bh.state.Protection[market.Name()] {
+		if err := bh.cancelProtectiveOrder(market, orderType, orderId, "to sell"); err != nil {
+			return err
+		}
+	}
+	return bh.state.save()
+}
+
+// cancelProtectiveOrder cancels a stopLoss or takeProfit order and forgets it. When we only log which orders we would
+// place, the order is left alone.
+func (bh BvvHandler) cancelProtectiveOrder(market BvvMarket, orderType string, orderId string, reason string) error {
+	if !bh.config.placeOrders() {
+		log.Printf("We should cancel %s order %s for %s %s", orderType, orderId, market.Name(), reason)
+		return nil
+	}
+	log.Printf("Cancelling %s order %s for %s %s", orderType, orderId, market.Name(), reason)
+	if _, err := bh.connection.CancelOrder(market.Name(), orderId); err != nil && !isOrderNotFound(err) {
+		return fmt.Errorf("could not cancel %s order %s: %e", orderType, orderId, err)
+	}
+	delete(bh.state.Protection[market.Name()], orderType)
+	return nil
+}
+
+// maintainProtection places the stopLoss or takeProfit order of a market, or updates it when the position or the
+// reference price has changed. Bitvavo holds the funds of every open order, so there is one protective order for the
+// whole position. When both are configured, the one with the trigger closest to the price is placed, and it is
+// replaced by the other one once the price moves closer to that trigger.
+func (bh BvvHandler) maintainProtection(market BvvMarket) error {
+	configs := protectionConfigs(market.config)
+	triggers := make(map[string]decimal.Decimal)
+	for _, orderType := range []string{orderTypeStopLoss, orderTypeTakeProfit} {
+		if !configs[orderType].Enabled() {
+			continue
+		}
+		trigger, err := bh.protectionTrigger(market, orderType, configs[orderType])
+		if err != nil {
+			log.Printf("Could not determine %s price for %s: %e", orderType, market.Name(), err)
+			continue
+		}
+		triggers[orderType] = trigger
+	}
+	active := activeProtection(market.Price, triggers)
+	var decimals int32
+	if asset, exists := bh.assets[market.From]; !exists {
+		return fmt.Errorf("unknown asset %s", market.From)
+	} else {
+		decimals = int32(asset.Decimals)
+	}
+	position := market.Total().Sub(market.PendingSell)
+	// New orders are placed after existing orders are updated or cancelled, which might free the funds they need
+	placements := make(map[string]protectivePlacement)
+	for _, orderType := range []string{orderTypeStopLoss, orderTypeTakeProfit} {
+		order, found, err := bh.protectiveOrder(market, orderType)
+		if err != nil {
+			return err
+		}
+		if orderType != active {
+			if found {
+				if err = bh.cancelProtectiveOrder(market, orderType, order.OrderId,
+					"which is not the protection now"); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		trigger := triggers[orderType]
+		amount := position.Truncate(decimals)
+		if amount.LessThan(market.MinimumAmount()) {
+			if found {
+				if err = bh.cancelProtectiveOrder(market, orderType, order.OrderId,
+					"since the position is too small"); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err = market.checkOrder(orderType, amount, trigger); err != nil {
+			log.Printf("%s.\n", err.Error())
+			continue
+		}
+		if !bh.config.placeOrders() {
+			log.Printf("We should have a %s order for %s %s at %s", orderType, amount, market.From, trigger)
+			continue
+		}
+		if found {
+			// Updates are checked against the risk limits like new orders, which submitWithinLimits does for those
+			if amount, err = bh.limitRisk(market, "sell", amount, trigger); err != nil {
+				if rErr, ok := err.(OrderRejectedError); ok {
+					log.Printf("%s.\n", rErr.Error())
+					continue
+				}
+				return err
+			}
+			if !protectionChanged(order, amount, trigger) {
+				continue
+			}
+			log.Printf("Updating %s order %s for %s: %s %s at %s", orderType, order.OrderId, market.Name(), amount,
+				market.From, trigger)
+			body := bvvOptions{"amount": amount.String(), "triggerAmount": trigger.String()}
+			if _, err = bh.connection.UpdateOrder(market.Name(), order.OrderId, body); err != nil {
+				return fmt.Errorf("could not update %s order %s: %e", orderType, order.OrderId, err)
+			}
+			continue
+		}
+		placements[orderType] = protectivePlacement{amount: amount, trigger: trigger}
+	}
+	for _, orderType := range []string{orderTypeStopLoss, orderTypeTakeProfit} {
+		placement, exists := placements[orderType]
+		if !exists {
+			continue
+		}
+		log.Printf("Placing %s order for %s: %s %s at %s", orderType, market.Name(), placement.amount, market.From,
+			placement.trigger)
+		order, placed, err := bh.submitWithinLimits(market, "sell", orderType, "", placement.amount, placement.trigger,
+			bvvOptions{"triggerAmount": placement.trigger.String(), "triggerType": "price",
+				"triggerReference": "lastTrade"})
+		if rErr, ok := err.(OrderRejectedError); ok {
+			log.Printf("%s.\n", rErr.Error())
+			continue
+		} else if err != nil {
+			return fmt.Errorf("could not place %s order: %e", orderType, err)
+		} else if !placed && !isOpen(order) {
+			continue
+		}
+		if bh.state.Protection[market.Name()] == nil {
+			bh.state.Protection[market.Name()] = make(map[string]string)
+		}
+		bh.state.Protection[market.Name()][orderType] = order.OrderId
+	}
+	return bh.state.save()
+}
+
+// activeProtection returns the order type of the trigger that is closest to the price, or an empty string when there
+// are no triggers
+func activeProtection(price decimal.Decimal, triggers map[string]decimal.Decimal) string {
+	stopLoss, hasStopLoss := triggers[orderTypeStopLoss]
+	takeProfit, hasTakeProfit := triggers[orderTypeTakeProfit]
+	switch {
+	case hasStopLoss && hasTakeProfit:
+		if takeProfit.Sub(price).LessThan(price.Sub(stopLoss)) {
+			return orderTypeTakeProfit
+		}
+		return orderTypeStopLoss
+	case hasStopLoss:
+		return orderTypeStopLoss
+	case hasTakeProfit:
+		return orderTypeTakeProfit
+	}
+	return ""
+}
+
+// protectionChanged returns true when an open stopLoss or takeProfit order differs from the amount and trigger
+func protectionChanged(order bitvavo.Order, amount decimal.Decimal, trigger decimal.Decimal) bool {
+	current, err := orderPrice(order)
+	if err != nil || !current.Equal(trigger) {
+		return true
+	}
+	currentAmount, err := decimal.NewFromString(order.Amount)
+	return err != nil || !currentAmount.Equal(amount)
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+func TestActiveProtection(t *testing.T) {
+	for _, test := range []struct {
+		price                string
+		stopLoss, takeProfit string
+		expected             string
+	}{
+		{price: "100", expected: ""},
+		{price: "100", stopLoss: "90", expected: orderTypeStopLoss},
+		{price: "100", takeProfit: "125", expected: orderTypeTakeProfit},
+		{price: "100", stopLoss: "90", takeProfit: "125", expected: orderTypeStopLoss},
+		{price: "110", stopLoss: "90", takeProfit: "125", expected: orderTypeTakeProfit},
+		{price: "107.5", stopLoss: "90", takeProfit: "125", expected: orderTypeStopLoss},
+		{price: "80", stopLoss: "90", takeProfit: "125", expected: orderTypeStopLoss},
+		{price: "130", stopLoss: "90", takeProfit: "125", expected: orderTypeTakeProfit},
+	} {
+		triggers := make(map[string]decimal.Decimal)
+		if test.stopLoss != "" {
+			triggers[orderTypeStopLoss] = decimal.RequireFromString(test.stopLoss)
+		}
+		if test.takeProfit != "" {
+			triggers[orderTypeTakeProfit] = decimal.RequireFromString(test.takeProfit)
+		}
+		if active := activeProtection(decimal.RequireFromString(test.price), triggers); active != test.expected {
+			t.Errorf("price %s with %v: expected %q, got %q", test.price, triggers, test.expected, active)
+		}
+	}
+}
+
+// TestProtectionDryRun checks that protective orders are only cancelled when orders are placed
+func TestProtectionDryRun(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		activeMode bool
+		takeProfit bool
+		canceled   int
+		placed     int
+	}{
+		{name: "disabled", activeMode: true, canceled: 1},
+		{name: "disabled dry-run"},
+		{name: "replaced", activeMode: true, takeProfit: true, canceled: 1, placed: 1},
+		{name: "replaced dry-run", takeProfit: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exchange := newFakeExchange()
+			config := BvvConfig{ActiveMode: test.activeMode, Markets: map[string]bvvMarketConfig{"ADA": {}}}
+			if test.takeProfit {
+				config.Markets["ADA"] = bvvMarketConfig{
+					TakeProfit: bvvProtectionConfig{Percent: decimal.NewFromInt(25), Reference: referenceRate},
+				}
+			}
+			bh := newTestHandler(t, config, exchange, map[string]string{"ADA-EUR": "0.5"})
+			market := newTestMarket(t, bh, "ADA", "100")
+			market.rate = Rate{From: decimal.NewFromInt(100), To: decimal.NewFromInt(50)}
+			exchange.addOrder(bitvavo.Order{OrderId: "stop", Market: market.Name(), Side: "sell", Status: "new",
+				OrderType: orderTypeStopLoss, Amount: "100", TriggerAmount: "0.45"})
+			bh.state.Protection[market.Name()] = map[string]string{orderTypeStopLoss: "stop"}
+
+			if err := bh.maintainProtection(market); err != nil {
+				t.Fatalf("could not maintain protection: %v", err)
+			}
+			if len(exchange.canceled) != test.canceled {
+				t.Errorf("expected %d canceled orders, got %v", test.canceled, exchange.canceled)
+			}
+			if len(exchange.placed) != test.placed {
+				t.Errorf("expected %d placed orders, got %v", test.placed, exchange.placed)
+			}
+			if exchange.orders["stop"].Status != "canceled" && test.canceled > 0 {
+				t.Errorf("expected stopLoss to be canceled, got %s", exchange.orders["stop"].Status)
+			}
+			_, tracked := bh.state.Protection[market.Name()][orderTypeStopLoss]
+			if tracked != (test.canceled == 0) {
+				t.Errorf("expected stopLoss to be tracked: %t, got %t", test.canceled == 0, tracked)
+			}
+		})
+	}
+}
+
+// TestCancelProtectionDryRun checks that selling in a dry run does not cancel the protective orders
+func TestCancelProtectionDryRun(t *testing.T) {
+	for _, activeMode := range []bool{true, false} {
+		exchange := newFakeExchange()
+		config := BvvConfig{ActiveMode: activeMode, Markets: map[string]bvvMarketConfig{"ADA": {}}}
+		bh := newTestHandler(t, config, exchange, map[string]string{"ADA-EUR": "0.5"})
+		market := newTestMarket(t, bh, "ADA", "100")
+		exchange.addOrder(bitvavo.Order{OrderId: "stop", Market: market.Name(), Side: "sell", Status: "new",
+			OrderType: orderTypeStopLoss})
+		bh.state.Protection[market.Name()] = map[string]string{orderTypeStopLoss: "stop"}
+		if err := bh.cancelProtection(market); err != nil {
+			t.Fatalf("could not cancel protection: %v", err)
+		}
+		if canceled := len(exchange.canceled) > 0; canceled != activeMode {
+			t.Errorf("activeMode %t: expected canceled to be %t, got %v", activeMode, activeMode, exchange.canceled)
+		}
+	}
+}
+
+// TestProtectionWithinLimits checks that a protective order which was lowered by the risk limits is not raised to the
+// whole position when it is updated
+func TestProtectionWithinLimits(t *testing.T) {
+	exchange := newFakeExchange()
+	config := BvvConfig{
+		ActiveMode: true,
+		Limits:     bvvLimitsConfig{MaxOrder: decimal.NewFromInt(10)},
+		Markets: map[string]bvvMarketConfig{"ADA": {
+			StopLoss: bvvProtectionConfig{Percent: decimal.NewFromInt(10), Reference: referenceRate},
+		}},
+	}
+	bh := newTestHandler(t, config, exchange, map[string]string{"ADA-EUR": "0.5"})
+	market := newTestMarket(t, bh, "ADA", "100")
+	market.rate = Rate{From: decimal.NewFromInt(100), To: decimal.NewFromInt(50)}
+	for run := 1; run <= 2; run++ {
+		if err := bh.maintainProtection(market); err != nil {
+			t.Fatalf("run %d: could not maintain protection: %v", run, err)
+		}
+		if len(exchange.placed) != 1 {
+			t.Fatalf("run %d: expected 1 placed order, got %v", run, exchange.placed)
+		}
+		orderId := bh.state.Protection[market.Name()][orderTypeStopLoss]
+		if order := exchange.orders[orderId]; order.Amount != "22.22222222" || order.TriggerAmount != "0.45" {
+			t.Errorf("run %d: expected stopLoss of 22.22222222 at 0.45, got %s at %s", run, order.Amount,
+				order.TriggerAmount)
+		}
+	}
+	if len(exchange.updated) != 0 {
+		t.Errorf("expected no updates, got %v", exchange.updated)
+	}
+	if len(bh.state.Volume) != 0 {
+		t.Errorf("expected protective orders not to be recorded, got %v", bh.state.Volume)
+	}
+}
@@ -22,10 +22,15 @@ func (r *Rate) ExchangeFromTrade(trade bitvavo.Trades) (err error) {
 		return fmt.Errorf("cannot convert `%s` to Decimal: %e", trade.Price, err)
 	} else {
 		dTo = dPrice.Mul(dFrom)
+		// The fee adds to what was paid for a buy, and is subtracted from what was received for a sell
+		fee, err := tradeFee(trade, dPrice)
+		if err != nil {
+			return err
+		}
 		if trade.Side == "buy" {
-			r.Buy(dFrom, dTo)
+			r.Buy(dFrom, dTo.Add(fee))
 		} else {
-			r.Sell(dFrom, dTo)
+			r.Sell(dFrom, dTo.Sub(fee))
 		}
 		//fmt.Printf("%d - %s (%s): %s/%s=%s (%s/%s)\n", trade.Timestamp, trade.Market, trade.Side, r.From, r.To, r.From.Div(r.To), dFrom, dTo)
 	}
@@ -48,3 +53,25 @@ func (r Rate) Average() (decimal.Decimal, error) {
 	}
 	return r.To.Div(r.From), nil
 }
+
+// tradeFee returns the fee of a trade in the quote currency of the market
+func tradeFee(trade bitvavo.Trades, price decimal.Decimal) (fee decimal.Decimal, err error) {
+	if trade.Fee == "" {
+		return decimal.Zero, nil
+	}
+	if fee, err = decimal.NewFromString(trade.Fee); err != nil {
+		return fee, fmt.Errorf("cannot convert `%s` to Decimal: %e", trade.Fee, err)
+	}
+	base, quote, err := splitMarket(trade.Market)
+	if err != nil {
+		return fee, err
+	}
+	switch trade.FeeCurrency {
+	case quote:
+		return fee, nil
+	case base:
+		return fee.Mul(price), nil
+	}
+	// Fees in other currencies (e.g. BTC discounts) do not affect the cost basis of this market
+	return decimal.Zero, nil
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+// tradedVolume is an order of a strategy, with its value in fiat
+type tradedVolume struct {
+	Market  string          `yaml:"market"`
+	OrderId string          `yaml:"orderId,omitempty"`
+	Time    int             `yaml:"time"`
+	Value   decimal.Decimal `yaml:"value"`
+}
+
+// riskLimit is a maximum value and how much of it is used already
+type riskLimit struct {
+	name string
+	max  decimal.Decimal
+	used decimal.Decimal
+}
+
+// orderValue returns the value in fiat of an amount of a market at a price
+func (bh BvvHandler) orderValue(market BvvMarket, amount decimal.Decimal, price decimal.Decimal) (decimal.Decimal,
+	error) {
+	quotePrice, err := bh.price(market.To, bh.config.Fiat)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return amount.Mul(price).Mul(quotePrice), nil
+}
+
+// usedVolume returns the value of the orders of a market (or all markets when market is empty) in this run and in the
+// last 24 hours, and the number of orders in the last 24 hours
+func (bh BvvHandler) usedVolume(market string, now int) (run decimal.Decimal, day decimal.Decimal, orders int) {
+	for _, volume := range bh.state.Volume {
+		if (market != "" && volume.Market != market) || volume.Time <= now-riskDayWindow {
+			continue
+		}
+		day = day.Add(volume.Value)
+		orders++
+		if volume.Time >= bh.runStart {
+			run = run.Add(volume.Value)
+		}
+	}
+	return run, day, orders
+}
+
+// limitRisk checks an order against the limits of all markets together and the limits of the market, before it is
+// placed. Orders that are worth more than a limit allows are lowered, and rejected when they would be below the
+// minimum of the market, or when the maximum number of orders is reached.
+func (bh BvvHandler) limitRisk(market BvvMarket, side string, amount decimal.Decimal, price decimal.Decimal) (
+	decimal.Decimal, error) {
+	value, err := bh.orderValue(market, amount, price)
+	if err != nil || !value.GreaterThan(decimal.Zero) {
+		return amount, err
+	}
+	now, err := bh.connection.Time()
+	if err != nil {
+		return amount, err
+	}
+	allowed, reason := value, ""
+	for _, scope := range []string{"", market.Name()} {
+		limits, of := bh.config.Limits, "all markets"
+		if scope != "" {
+			limits, of = market.config.Limits, scope
+		}
+		run, day, orders := bh.usedVolume(scope, now.Time)
+		if limits.MaxOrdersPerDay > 0 && orders >= limits.MaxOrdersPerDay {
+			return decimal.Zero, newOrderRejectedError(market.Name(),
+				"the maximum of %d orders per 24 hours for %s is reached", limits.MaxOrdersPerDay, of)
+		}
+		for _, limit := range []riskLimit{
+			{name: "per order", max: limits.MaxOrder},
+			{name: "per run", max: limits.MaxRun, used: run},
+			{name: "per 24 hours", max: limits.MaxDay, used: day},
+		} {
+			if !limit.max.GreaterThan(decimal.Zero) {
+				continue
+			}
+			if remaining := decimal.Max(limit.max.Sub(limit.used), decimal.Zero); allowed.GreaterThan(remaining) {
+				allowed = remaining
+				reason = fmt.Sprintf("maximum of %s %s %s for %s", limit.max, bh.config.Fiat, limit.name, of)
+			}
+		}
+	}
+	if allowed.Equal(value) {
+		return amount, nil
+	}
+	lowered := amount.Mul(allowed).Div(value)
+	if asset, exists := bh.assets[market.From]; exists {
+		lowered = lowered.Truncate(int32(asset.Decimals))
+	}
+	if lowered.LessThan(market.minimumAmountAt(price)) {
+		return decimal.Zero, newOrderRejectedError(market.Name(), "%s %s would exceed the %s", side, amount, reason)
+	}
+	log.Printf("%s: lowering %s from %s to %s to stay within the %s", market.Name(), side, amount, lowered, reason)
+	return lowered, nil
+}
+
+// recordVolume saves an order of a strategy for the risk limits, and forgets orders older than 24 hours
+func (bh BvvHandler) recordVolume(market BvvMarket, orderId string, amount decimal.Decimal,
+	price decimal.Decimal) error {
+	value, err := bh.orderValue(market, amount, price)
+	if err != nil {
+		return err
+	}
+	now, err := bh.connection.Time()
+	if err != nil {
+		return err
+	}
+	var volumes []tradedVolume
+	for _, volume := range bh.state.Volume {
+		if volume.Time > now.Time-riskDayWindow {
+			volumes = append(volumes, volume)
+		}
+	}
+	bh.state.Volume = append(volumes, tradedVolume{Market: market.Name(), OrderId: orderId, Time: now.Time,
+		Value: value})
+	return bh.state.save()
+}
+
+// releaseVolume lowers the recorded value of an order that is done without being filled completely, to the part that
+// was filled. An order that was not filled at all no longer counts, so cancelling and placing an unfilled order again
+// is only counted once.
+func (bh BvvHandler) releaseVolume(orderId string, filled decimal.Decimal, amount decimal.Decimal) {
+	for i, volume := range bh.state.Volume {
+		if volume.OrderId != orderId {
+			continue
+		}
+		if !filled.GreaterThan(decimal.Zero) || !amount.GreaterThan(decimal.Zero) {
+			bh.state.Volume = append(bh.state.Volume[:i], bh.state.Volume[i+1:]...)
+		} else if filled.LessThan(amount) {
+			bh.state.Volume[i].Value = volume.Value.Mul(filled).Div(amount)
+		}
+		return
+	}
+}
+
+// submitWithinLimits places an order of a strategy with submitOrder, after checking it against the risk limits and the
+// rules of the market, and records its volume when it is placed. All orders go through here, so none of them can
+// bypass the limits. Protective orders are checked, but only hold funds until they are triggered, so their volume is
+// not recorded. The amount should already be rounded, since it is not raised anymore after the risk check.
+func (bh BvvHandler) submitWithinLimits(market BvvMarket, side string, orderType string, slot string,
+	amount decimal.Decimal, price decimal.Decimal, body bvvOptions) (order bitvavo.Order, placed bool, err error) {
+	if amount, err = bh.limitRisk(market, side, amount, price); err != nil {
+		return order, false, err
+	}
+	if err = market.checkOrder(orderType, amount, price); err != nil {
+		return order, false, err
+	}
+	body["amount"] = amount.String()
+	if order, placed, err = bh.submitOrder(market.Name(), side, orderType, slot, body); err != nil || !placed ||
+		isProtective(orderType) {
+		return order, placed, err
+	}
+	return order, true, bh.recordVolume(market, order.OrderId, amount, price)
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+func TestLimitRisk(t *testing.T) {
+	const hour = 60 * 60 * 1000
+	for _, test := range []struct {
+		name     string
+		global   bvvLimitsConfig
+		market   bvvLimitsConfig
+		volume   []tradedVolume
+		expected string
+		rejected bool
+	}{
+		{name: "no limits", expected: "100"},
+		{name: "max order", global: bvvLimitsConfig{MaxOrder: decimal.NewFromInt(20)}, expected: "40"},
+		{name: "lowest max order", global: bvvLimitsConfig{MaxOrder: decimal.NewFromInt(20)},
+			market: bvvLimitsConfig{MaxOrder: decimal.NewFromInt(10)}, expected: "20"},
+		{name: "max run", global: bvvLimitsConfig{MaxRun: decimal.NewFromInt(30)},
+			volume: []tradedVolume{{Market: "ADA-EUR", Value: decimal.NewFromInt(20)}}, expected: "20"},
+		{name: "earlier run", global: bvvLimitsConfig{MaxRun: decimal.NewFromInt(30)},
+			volume:   []tradedVolume{{Market: "ADA-EUR", Time: -hour, Value: decimal.NewFromInt(20)}},
+			expected: "60"},
+		{name: "max day", global: bvvLimitsConfig{MaxDay: decimal.NewFromInt(60)},
+			volume: []tradedVolume{{Market: "ADA-EUR", Time: -hour, Value: decimal.NewFromInt(50)}}, expected: "20"},
+		{name: "older than a day", global: bvvLimitsConfig{MaxDay: decimal.NewFromInt(60)},
+			volume:   []tradedVolume{{Market: "ADA-EUR", Time: -25 * hour, Value: decimal.NewFromInt(50)}},
+			expected: "100"},
+		{name: "below minimum", global: bvvLimitsConfig{MaxDay: decimal.NewFromInt(60)},
+			volume: []tradedVolume{{Market: "ADA-EUR", Time: -hour, Value: decimal.NewFromInt(57)}}, rejected: true},
+		{name: "max orders per day", market: bvvLimitsConfig{MaxOrdersPerDay: 2},
+			volume: []tradedVolume{
+				{Market: "ADA-EUR", Time: -2 * hour, Value: decimal.NewFromInt(1)},
+				{Market: "ADA-EUR", Time: -hour, Value: decimal.NewFromInt(1)},
+			}, rejected: true},
+		{name: "other market for all markets", global: bvvLimitsConfig{MaxDay: decimal.NewFromInt(100)},
+			volume: []tradedVolume{{Market: "BTC-EUR", Time: -hour, Value: decimal.NewFromInt(80)}}, expected: "40"},
+		{name: "other market for market", market: bvvLimitsConfig{MaxDay: decimal.NewFromInt(30)},
+			volume: []tradedVolume{{Market: "BTC-EUR", Time: -hour, Value: decimal.NewFromInt(80)}}, expected: "60"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exchange := newFakeExchange()
+			config := BvvConfig{Limits: test.global, Markets: map[string]bvvMarketConfig{"ADA": {Limits: test.market}}}
+			bh := newTestHandler(t, config, exchange, map[string]string{"ADA-EUR": "0.5", "BTC-EUR": "30000"})
+			market := newTestMarket(t, bh, "ADA", "0")
+			for _, volume := range test.volume {
+				volume.Time += exchange.now
+				bh.state.Volume = append(bh.state.Volume, volume)
+			}
+			amount, err := bh.limitRisk(market, "buy", decimal.NewFromInt(100), market.Price)
+			if _, rejected := err.(OrderRejectedError); rejected != test.rejected {
+				t.Fatalf("expected rejected to be %t, got %v", test.rejected, err)
+			} else if err != nil && !rejected {
+				t.Fatalf("could not limit risk: %v", err)
+			} else if !rejected && !amount.Equal(decimal.RequireFromString(test.expected)) {
+				t.Errorf("expected %s, got %s", test.expected, amount)
+			}
+		})
+	}
+}
+
+func TestReleaseVolume(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		orderId  string
+		filled   string
+		expected []string
+	}{
+		{name: "not filled", orderId: "first", filled: "0", expected: []string{"20"}},
+		{name: "partially filled", orderId: "first", filled: "25", expected: []string{"2.5", "20"}},
+		{name: "filled", orderId: "first", filled: "100", expected: []string{"10", "20"}},
+		{name: "unknown order", orderId: "other", filled: "0", expected: []string{"10", "20"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			bh := newTestHandler(t, BvvConfig{}, newFakeExchange(), nil)
+			bh.state.Volume = []tradedVolume{
+				{Market: "ADA-EUR", OrderId: "first", Value: decimal.NewFromInt(10)},
+				{Market: "ADA-EUR", OrderId: "second", Value: decimal.NewFromInt(20)},
+			}
+			bh.releaseVolume(test.orderId, decimal.RequireFromString(test.filled), decimal.NewFromInt(100))
+			if len(bh.state.Volume) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, bh.state.Volume)
+			}
+			for i, value := range test.expected {
+				if !bh.state.Volume[i].Value.Equal(decimal.RequireFromString(value)) {
+					t.Errorf("expected %s for volume %d, got %s", value, i, bh.state.Volume[i].Value)
+				}
+			}
+		})
+	}
+}
+
+// TestCancelUnfilledVolume checks that an unfilled limit order which is cancelled to be placed again no longer counts
+// for the risk limits
+func TestCancelUnfilledVolume(t *testing.T) {
+	exchange := newFakeExchange()
+	config := BvvConfig{ActiveMode: true, Markets: map[string]bvvMarketConfig{"ADA": {
+		OrderType: orderTypeLimit,
+		Unfilled:  unfilledCancel,
+		Limits:    bvvLimitsConfig{MaxOrdersPerDay: 1},
+	}}}
+	bh := newTestHandler(t, config, exchange, map[string]string{"ADA-EUR": "0.5"})
+	market := newTestMarket(t, bh, "ADA", "0")
+	order := bitvavo.Order{OrderId: "unfilled", Market: market.Name(), Side: "buy", OrderType: orderTypeLimit,
+		Status: "new", Amount: "100", FilledAmount: "0", Price: "0.49"}
+	exchange.addOrder(order)
+	if err := bh.trackOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	price := decimal.RequireFromString(order.Price)
+	if err := bh.recordVolume(market, order.OrderId, decimal.NewFromInt(100), price); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bh.limitRisk(market, "buy", decimal.NewFromInt(100), market.Price); err == nil {
+		t.Fatalf("expected the maximum number of orders to be reached")
+	}
+	open, err := bh.handleUnfilled(market, []bitvavo.Order{order})
+	if err != nil {
+		t.Fatalf("could not handle unfilled orders: %v", err)
+	}
+	if len(open) != 0 || len(exchange.canceled) != 1 {
+		t.Fatalf("expected the order to be canceled, got open %v and canceled %v", open, exchange.canceled)
+	}
+	if len(bh.state.Volume) != 0 || len(bh.state.Orders) != 0 {
+		t.Errorf("expected the order to be settled, got volume %v and orders %v", bh.state.Volume, bh.state.Orders)
+	}
+	if _, err = bh.limitRisk(market, "buy", decimal.NewFromInt(100), market.Price); err != nil {
+		t.Errorf("expected the order to be placed again, got %v", err)
+	}
+}
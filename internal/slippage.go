@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/shopspring/decimal"
+)
+
+// limitSlippage returns the largest part of amount that can be filled by a market order, with an estimated average
+// fill price within maxSlippagePercent of the price of the market. The estimate walks the asks (for buying) or the
+// bids (for selling) of the order book.
+func (bh BvvHandler) limitSlippage(market BvvMarket, side string, amount decimal.Decimal) (decimal.Decimal, error) {
+	book, err := bh.connection.Book(market.Name(), bvvOptions{"depth": fmt.Sprintf("%d", slippageBookDepth)})
+	if err != nil {
+		return amount, fmt.Errorf("could not get order book for market %s: %e", market.Name(), err)
+	}
+	offset := market.config.MaxSlippagePercent.Div(decimal.NewFromInt(100))
+	levels := book.Asks
+	limit := market.Price.Mul(decimal.NewFromInt(1).Add(offset))
+	if side == "sell" {
+		levels = book.Bids
+		limit = market.Price.Mul(decimal.NewFromInt(1).Sub(offset))
+	}
+	filled, value := decimal.Zero, decimal.Zero
+	for _, level := range levels {
+		if len(level) < 2 {
+			return amount, fmt.Errorf("invalid order book level %v for market %s", level, market.Name())
+		}
+		price, err := decimal.NewFromString(level[0])
+		if err != nil {
+			return amount, fmt.Errorf("could not convert price to Decimal %s: %e", level[0], err)
+		}
+		size, err := decimal.NewFromString(level[1])
+		if err != nil {
+			return amount, fmt.Errorf("could not convert size to Decimal %s: %e", level[1], err)
+		}
+		size = decimal.Min(size, amount.Sub(filled))
+		if (side == "buy" && price.GreaterThan(limit)) || (side == "sell" && price.LessThan(limit)) {
+			// Only take as much from this level as keeps the average at the limit:
+			// (value + size * price) / (filled + size) = limit
+			size = decimal.Min(size, limit.Mul(filled).Sub(value).Div(price.Sub(limit)))
+			if size.GreaterThan(decimal.Zero) {
+				filled, value = filled.Add(size), value.Add(size.Mul(price))
+			}
+			break
+		}
+		filled, value = filled.Add(size), value.Add(size.Mul(price))
+		if filled.GreaterThanOrEqual(amount) {
+			break
+		}
+	}
+	if filled.GreaterThanOrEqual(amount) {
+		return amount, nil
+	}
+	if filled.LessThan(market.MinimumAmount()) {
+		return decimal.Zero, newOrderRejectedError(market.Name(),
+			"%s %s would move the price more than %s%%, and the order book has too little depth for the minimum order",
+			side, amount, market.config.MaxSlippagePercent)
+	}
+	log.Printf("%s: lowering %s from %s to %s (average %s) to stay within %s%% slippage", market.Name(), side,
+		amount, filled, value.Div(filled).Round(8), market.config.MaxSlippagePercent)
+	return filled, nil
+}
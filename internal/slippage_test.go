@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+func TestLimitSlippage(t *testing.T) {
+	asks := [][]string{{"0.5", "100"}, {"0.504", "100"}, {"0.52", "1000"}}
+	bids := [][]string{{"0.5", "100"}, {"0.49", "1000"}}
+	for _, test := range []struct {
+		name     string
+		side     string
+		amount   string
+		book     bitvavo.Book
+		expected string
+		rejected bool
+		invalid  bool
+	}{
+		{name: "first level", side: "buy", amount: "50", book: bitvavo.Book{Asks: asks}, expected: "50"},
+		{name: "within limit", side: "buy", amount: "150", book: bitvavo.Book{Asks: asks}, expected: "150"},
+		{name: "average at limit", side: "buy", amount: "500", book: bitvavo.Book{Asks: asks}, expected: "240"},
+		{name: "too thin", side: "buy", amount: "50", book: bitvavo.Book{Asks: [][]string{{"0.6", "1000"}}},
+			rejected: true},
+		{name: "empty book", side: "buy", amount: "50", rejected: true},
+		{name: "sell within limit", side: "sell", amount: "150", book: bitvavo.Book{Bids: bids}, expected: "150"},
+		{name: "sell average at limit", side: "sell", amount: "500", book: bitvavo.Book{Bids: bids},
+			expected: "200"},
+		{name: "invalid level", side: "buy", amount: "50", book: bitvavo.Book{Asks: [][]string{{"0.5"}}},
+			invalid: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exchange := newFakeExchange()
+			exchange.book = test.book
+			config := BvvConfig{Markets: map[string]bvvMarketConfig{"ADA": {MaxSlippagePercent: decimal.NewFromInt(1)}}}
+			bh := newTestHandler(t, config, exchange, map[string]string{"ADA-EUR": "0.5"})
+			market := newTestMarket(t, bh, "ADA", "1000")
+			amount, err := bh.limitSlippage(market, test.side, decimal.RequireFromString(test.amount))
+			_, rejected := err.(OrderRejectedError)
+			switch {
+			case test.invalid:
+				if err == nil || rejected {
+					t.Errorf("expected an error for an invalid order book, got %v", err)
+				}
+			case rejected != test.rejected:
+				t.Errorf("expected rejected to be %t, got %v", test.rejected, err)
+			case err != nil && !rejected:
+				t.Errorf("could not limit slippage: %v", err)
+			case !rejected && !amount.Equal(decimal.RequireFromString(test.expected)):
+				t.Errorf("expected %s, got %s", test.expected, amount)
+			}
+		})
+	}
+}
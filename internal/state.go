@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// bvvState holds everything bvv_moneymaker needs to remember between runs
+type bvvState struct {
+	file string
+	// Orders that where placed and are not filled or canceled yet, by order id
+	Orders map[string]trackedOrder `yaml:"orders"`
+	// Order ids of the stopLoss and takeProfit orders, by market and order type
+	Protection map[string]map[string]string `yaml:"protection"`
+	// The highest price since the strategy wanted to sell, by market
+	Trailing map[string]trailingHigh `yaml:"trailing"`
+	// Orders of the current evaluation window, by client order id
+	Intents map[string]orderIntent `yaml:"intents"`
+	// No orders are placed while trading is halted
+	Halted bool `yaml:"halted"`
+	// The time (in ms) of the last dca buy, by market
+	DCA map[string]int `yaml:"dca"`
+	// The open orders of the grid strategy, by market and level
+	Grid map[string]map[int]gridLevel `yaml:"grid"`
+	// The orders of the strategies in the last 24 hours, for the risk limits
+	Volume []tradedVolume `yaml:"volume"`
+}
+
+// loadState reads the state from file. Without a file the state is only kept in memory.
+func loadState(file string) (state *bvvState, err error) {
+	state = &bvvState{file: file}
+	if file != "" {
+		// The state file is configured by the operator
+		// #nosec
+		yamlState, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		} else if err == nil {
+			if err = yaml.Unmarshal(yamlState, state); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if state.Orders == nil {
+		state.Orders = make(map[string]trackedOrder)
+	}
+	if state.Protection == nil {
+		state.Protection = make(map[string]map[string]string)
+	}
+	if state.Trailing == nil {
+		state.Trailing = make(map[string]trailingHigh)
+	}
+	if state.Intents == nil {
+		state.Intents = make(map[string]orderIntent)
+	}
+	if state.DCA == nil {
+		state.DCA = make(map[string]int)
+	}
+	if state.Grid == nil {
+		state.Grid = make(map[string]map[int]gridLevel)
+	}
+	return state, nil
+}
+
+func (s *bvvState) save() error {
+	if s.file == "" {
+		return nil
+	}
+	yamlState, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.file, yamlState)
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and renames it to file, so a crash while
+// writing does not leave a corrupt file behind. The file is only readable by the owner.
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
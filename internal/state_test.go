@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "bvvstate.yaml")
+	for _, data := range []string{"first: 1\n", "second: 2\n"} {
+		if err := writeFileAtomic(file, []byte(data)); err != nil {
+			t.Fatalf("could not write %s: %v", file, err)
+		}
+		written, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(written) != data {
+			t.Errorf("expected %q, got %q", data, written)
+		}
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected only %s, got %d files", file, len(files))
+	} else if mode := files[0].Mode().Perm(); mode != 0600 {
+		t.Errorf("expected mode 0600, got %o", mode)
+	}
+	if err = writeFileAtomic(filepath.Join(dir, "missing", "bvvstate.yaml"), nil); err == nil {
+		t.Errorf("expected an error for a missing directory")
+	}
+}
+
+// TestPaperWalletSave checks that the paper wallet is saved and read again
+func TestPaperWalletSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bvvpaper.yaml")
+	pe := &PaperExchange{stateFile: file, wallet: paperWallet{
+		Balances: map[string]decimal.Decimal{"EUR": decimal.NewFromInt(1000)},
+	}}
+	if err := pe.save(); err != nil {
+		t.Fatalf("could not save paper wallet: %v", err)
+	}
+	loaded := &PaperExchange{stateFile: file}
+	if err := loaded.load(); err != nil {
+		t.Fatalf("could not load paper wallet: %v", err)
+	}
+	if balance := loaded.wallet.Balances["EUR"]; !balance.Equal(decimal.NewFromInt(1000)) {
+		t.Errorf("expected 1000 EUR, got %s", balance)
+	}
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+const defaultStrategy = "minmax"
+
+// PlannedOrder is an order a Strategy intends to place. Amount is in the From currency of the market.
+type PlannedOrder struct {
+	Side   string
+	Amount decimal.Decimal
+	Reason string
+	// DCA is set for buys that include the dca amount of the market
+	DCA bool
+}
+
+// Strategy decides which orders to place for a market. The BvvMarket is a snapshot holding the price, the balances,
+// the Rate and the MAHandler with the indicators of the market.
+type Strategy interface {
+	Evaluate(market BvvMarket) (orders []PlannedOrder, err error)
+}
+
+type strategyFactory func(bh *BvvHandler, config bvvMarketConfig) (Strategy, error)
+
+var strategies = map[string]strategyFactory{
+	"minmax": newMinMaxStrategy,
+	"ema":    newEMAStrategy,
+	"grid":   newGridStrategy,
+	"weight": newWeightStrategy,
+}
+
+// newStrategy returns the strategy as configured for a market
+func newStrategy(bh *BvvHandler, config bvvMarketConfig) (Strategy, error) {
+	name := config.Strategy
+	if name == "" {
+		name = defaultStrategy
+	}
+	factory, exists := strategies[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown strategy %s", name)
+	}
+	return factory(bh, config)
+}
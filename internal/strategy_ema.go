@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// emaStrategy buys when the price is more than buyPercent under the expected rate, and sells when it is more than
+// sellPercent over the expected rate. The order size scales with how far the price is towards the edge of the
+// bandwidth: at the minimum (or maximum) of the bandwidth, the full amount is bought (or sold).
+// The deviation is calculated with the price including the fee, so the percentages are net of fees.
+type emaStrategy struct {
+	config bvvDeviationConfig
+}
+
+func newEMAStrategy(bh *BvvHandler, config bvvMarketConfig) (Strategy, error) {
+	if !config.MAConfig.Enabled() {
+		return nil, fmt.Errorf("strategy ema requires an ema configuration")
+	}
+	if !config.Deviation.Amount.GreaterThan(decimal.Zero) {
+		return nil, fmt.Errorf("strategy ema requires deviation.amount to be set")
+	}
+	return emaStrategy{config: config.Deviation}, nil
+}
+
+func (es emaStrategy) Evaluate(market BvvMarket) (orders []PlannedOrder, err error) {
+	expectedRate, err := market.GetExpectedRate()
+	if err != nil {
+		return nil, err
+	}
+	bw, err := market.GetBandWidth()
+	if err != nil {
+		return nil, err
+	}
+	// The amount is in fiat
+	fiatPrice, err := market.fiatPrice()
+	if err != nil {
+		return nil, err
+	}
+	hundred := decimal.NewFromInt(100)
+	if expectedRate.GreaterThan(market.Price) {
+		deviation := expectedRate.Sub(market.buyPrice()).Div(expectedRate).Mul(hundred)
+		if deviation.LessThanOrEqual(es.config.BuyPercent) {
+			return nil, nil
+		}
+		amount := es.config.Amount.Mul(bandwidthScale(expectedRate.Sub(market.Price), expectedRate.Sub(bw.Min)))
+		amount = amount.Div(fiatPrice)
+		if market.Max.GreaterThan(decimal.Zero) {
+			amount = decimal.Min(amount, market.Max.Sub(market.Projected()))
+		}
+		if !amount.GreaterThan(decimal.Zero) {
+			return nil, nil
+		}
+		return []PlannedOrder{{Side: "buy", Amount: amount,
+			Reason: fmt.Sprintf("%s%% under expected rate", deviation.Round(2))}}, nil
+	}
+	deviation := market.sellPrice().Sub(expectedRate).Div(expectedRate).Mul(hundred)
+	if deviation.LessThanOrEqual(es.config.SellPercent) {
+		return nil, nil
+	}
+	amount := es.config.Amount.Mul(bandwidthScale(market.Price.Sub(expectedRate), bw.Max.Sub(expectedRate)))
+	amount = decimal.Min(amount.Div(fiatPrice), market.Projected().Sub(market.Min))
+	if !amount.GreaterThan(decimal.Zero) {
+		return nil, nil
+	}
+	return []PlannedOrder{{Side: "sell", Amount: amount,
+		Reason: fmt.Sprintf("%s%% over expected rate", deviation.Round(2))}}, nil
+}
+
+// bandwidthScale returns distance / width, limited between 0 and 1
+func bandwidthScale(distance decimal.Decimal, width decimal.Decimal) decimal.Decimal {
+	one := decimal.NewFromInt(1)
+	if !width.GreaterThan(decimal.Zero) || distance.GreaterThanOrEqual(width) {
+		return one
+	}
+	if distance.LessThan(decimal.Zero) {
+		return decimal.Zero
+	}
+	return distance.Div(width)
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+// gridLevel is the open order on a level of a grid
+type gridLevel struct {
+	Side    string `yaml:"side"`
+	OrderId string `yaml:"orderId"`
+}
+
+// gridStrategy keeps limit buys on the levels below the price and limit sells on the levels above it. When an order
+// fills, the opposite order is placed one level away. The grid places its own orders, so it plans no orders.
+type gridStrategy struct {
+	handler *BvvHandler
+	config  bvvGridConfig
+}
+
+func newGridStrategy(bh *BvvHandler, config bvvMarketConfig) (Strategy, error) {
+	grid := config.Grid
+	if grid.Levels < 2 {
+		return nil, fmt.Errorf("strategy grid requires at least 2 grid.levels")
+	}
+	if !grid.Low.GreaterThan(decimal.Zero) || !grid.High.GreaterThan(grid.Low) {
+		return nil, fmt.Errorf("strategy grid requires grid.high to be above grid.low, which should be above 0")
+	}
+	if !grid.Amount.GreaterThan(decimal.Zero) {
+		return nil, fmt.Errorf("strategy grid requires grid.amount to be set")
+	}
+	return gridStrategy{handler: bh, config: grid}, nil
+}
+
+func (gs gridStrategy) Evaluate(market BvvMarket) (orders []PlannedOrder, err error) {
+	return nil, gs.handler.maintainGrid(market, gs.config)
+}
+
+// gridPrices returns the price of every level of a grid, from low to high
+func gridPrices(market BvvMarket, config bvvGridConfig) (prices []decimal.Decimal) {
+	step := config.High.Sub(config.Low).Div(decimal.NewFromInt(int64(config.Levels - 1)))
+	for i := 0; i < config.Levels; i++ {
+		prices = append(prices, market.roundPrice(config.Low.Add(step.Mul(decimal.NewFromInt(int64(i))))))
+	}
+	return prices
+}
+
+// isGridOrder returns true for orders that where placed by the grid strategy of a market
+func (bh BvvHandler) isGridOrder(market BvvMarket, orderId string) bool {
+	for _, level := range bh.state.Grid[market.Name()] {
+		if level.OrderId == orderId {
+			return true
+		}
+	}
+	return false
+}
+
+// maintainGrid follows up on the orders of a grid. A new grid gets an order on every level, except on the level that
+// is nearest to the price. Levels of orders that where canceled outside of the grid stay empty, and when all orders
+// are gone, the grid starts over. Orders on levels that where removed from the config are cancelled.
+func (bh BvvHandler) maintainGrid(market BvvMarket, config bvvGridConfig) error {
+	prices := gridPrices(market, config)
+	levels := bh.state.Grid[market.Name()]
+	if levels == nil {
+		levels = make(map[int]gridLevel)
+		bh.state.Grid[market.Name()] = levels
+	}
+	if len(levels) == 0 {
+		nearest := 0
+		for i, price := range prices {
+			if price.Sub(market.Price).Abs().LessThan(prices[nearest].Sub(market.Price).Abs()) {
+				nearest = i
+			}
+		}
+		log.Printf("%s: starting grid of %d levels between %s and %s", market.Name(), config.Levels, config.Low,
+			config.High)
+		// Levels that cannot be funded stay empty
+		quote, available := bh.balances[market.To].Available, market.Available
+		for i, price := range prices {
+			side, cost := "buy", config.Amount.Mul(price).Mul(decimal.NewFromInt(1).Add(market.feeRate()))
+			if i == nearest {
+				continue
+			} else if price.GreaterThan(market.Price) {
+				side = "sell"
+			}
+			if side == "buy" && cost.GreaterThan(quote) {
+				log.Printf("%s: not enough %s for grid buy on level %d", market.Name(), market.To, i)
+				continue
+			} else if side == "sell" && config.Amount.GreaterThan(available) {
+				log.Printf("%s: not enough %s for grid sell on level %d", market.Name(), market.From, i)
+				continue
+			}
+			if err := bh.placeGridOrder(market, config, levels, i, side, price, "start"); err != nil {
+				return err
+			}
+			if side == "buy" {
+				quote = quote.Sub(cost)
+			} else {
+				available = available.Sub(config.Amount)
+			}
+		}
+		return bh.state.save()
+	}
+	// Filled orders are collected first, so a level which is freed in this run can be used for the opposite order.
+	// Their levels are released after the opposite order is placed, so a repeated run places the same order again.
+	var filled []bitvavo.Order
+	var filledLevels []int
+	filledIds := make(map[string]bool)
+	var indexes []int
+	for i := range levels {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		level := levels[i]
+		if i < 0 || i >= len(prices) {
+			// The grid has fewer levels than when the order was placed
+			if !bh.config.placeOrders() {
+				log.Printf("%s: we should cancel grid %s order %s on level %d, the grid has %d levels now",
+					market.Name(), level.Side, level.OrderId, i, len(prices))
+				continue
+			}
+			log.Printf("%s: cancelling grid %s order %s on level %d, the grid has %d levels now", market.Name(),
+				level.Side, level.OrderId, i, len(prices))
+			if _, err := bh.connection.CancelOrder(market.Name(), level.OrderId); err != nil && !isOrderNotFound(err) {
+				return fmt.Errorf("could not cancel grid order %s: %e", level.OrderId, err)
+			}
+			delete(levels, i)
+			continue
+		}
+		order, err := bh.connection.GetOrder(market.Name(), level.OrderId)
+		if isOrderNotFound(err) {
+			log.Printf("%s: grid %s order %s on level %d does not exist anymore", market.Name(), level.Side,
+				level.OrderId, i)
+			delete(levels, i)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("could not get grid order %s: %e", level.OrderId, err)
+		} else if isOpen(order) {
+			continue
+		} else if order.Status != "filled" {
+			log.Printf("%s: grid %s order %s on level %d is %s", market.Name(), level.Side, level.OrderId, i,
+				order.Status)
+			delete(levels, i)
+			continue
+		}
+		filled = append(filled, order)
+		filledLevels = append(filledLevels, i)
+		filledIds[order.OrderId] = true
+	}
+	for j, order := range filled {
+		i, side, target := filledLevels[j], "sell", filledLevels[j]+1
+		if order.Side == "sell" {
+			side, target = "buy", i-1
+		}
+		log.Printf("%s: grid %s on level %d (%s) is filled", market.Name(), order.Side, i, prices[i])
+		if target < 0 || target >= len(prices) {
+			log.Printf("%s: no grid level to %s on, the price left the grid", market.Name(), side)
+		} else if other, occupied := levels[target]; occupied && !filledIds[other.OrderId] {
+			log.Printf("%s: grid level %d already has an order", market.Name(), target)
+		} else if err := bh.placeGridOrder(market, config, levels, target, side, prices[target],
+			order.OrderId); err != nil {
+			return err
+		}
+		if levels[i].OrderId == order.OrderId {
+			delete(levels, i)
+		}
+	}
+	return bh.state.save()
+}
+
+// placeGridOrder places a limit order on a level of a grid. The order that caused it (or start for a new grid) is
+// part of the client order id, so every fill leads to one new order, also when a run is repeated.
+func (bh BvvHandler) placeGridOrder(market BvvMarket, config bvvGridConfig, levels map[int]gridLevel, level int,
+	side string, price decimal.Decimal, cause string) error {
+	var decimals int32
+	if asset, exists := bh.assets[market.From]; !exists {
+		return fmt.Errorf("unknown asset %s", market.From)
+	} else {
+		decimals = int32(asset.Decimals)
+	}
+	amount := config.Amount.Truncate(decimals)
+	if err := market.checkOrder(orderTypeLimit, amount, price); err != nil {
+		log.Printf("%s.\n", err.Error())
+		return nil
+	}
+	if !bh.config.placeOrders() {
+		log.Printf("We should %s %s %s at %s on grid level %d", side, amount, market.From, price, level)
+		return nil
+	}
+	log.Printf("Placing grid %s order for %s: %s %s at %s on level %d", side, market.Name(), amount, market.From,
+		price, level)
+	order, placed, err := bh.submitWithinLimits(market, side, orderTypeLimit,
+		fmt.Sprintf("grid-%d-%s", level, cause), amount, price, bvvOptions{"price": price.String()})
+	if rErr, ok := err.(OrderRejectedError); ok {
+		log.Printf("%s.\n", rErr.Error())
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not place grid order: %e", err)
+	}
+	if placed && side == "buy" {
+		// Grid orders are placed before the buys of the other markets are funded, which should not count on this
+		if amount, err = decimal.NewFromString(order.Amount); err != nil {
+			return fmt.Errorf("could not convert amount of grid order %s to Decimal %s: %e", order.OrderId,
+				order.Amount, err)
+		}
+		bh.reserve(market.To, amount.Mul(price).Mul(decimal.NewFromInt(1).Add(market.feeRate())))
+	}
+	levels[level] = gridLevel{Side: side, OrderId: order.OrderId}
+	return nil
+}
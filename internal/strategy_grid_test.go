@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/bitvavo/go-bitvavo-api"
+	"github.com/shopspring/decimal"
+)
+
+func TestGridPrices(t *testing.T) {
+	bh := newTestHandler(t, BvvConfig{}, newFakeExchange(), map[string]string{"ADA-EUR": "0.5"})
+	market := newTestMarket(t, bh, "ADA", "0")
+	for _, test := range []struct {
+		low, high string
+		levels    int
+		expected  []string
+	}{
+		{"0.4", "0.6", 3, []string{"0.4", "0.5", "0.6"}},
+		{"0.4", "0.6", 2, []string{"0.4", "0.6"}},
+		{"1", "2", 4, []string{"1", "1.3333", "1.6667", "2"}},
+	} {
+		config := bvvGridConfig{Low: decimal.RequireFromString(test.low), High: decimal.RequireFromString(test.high),
+			Levels: test.levels}
+		prices := gridPrices(market, config)
+		if len(prices) != len(test.expected) {
+			t.Fatalf("%s-%s in %d levels: expected %v, got %v", test.low, test.high, test.levels, test.expected,
+				prices)
+		}
+		for i, price := range prices {
+			if !price.Equal(decimal.RequireFromString(test.expected[i])) {
+				t.Errorf("%s-%s in %d levels: expected %s on level %d, got %s", test.low, test.high, test.levels,
+					test.expected[i], i, price)
+			}
+		}
+	}
+}
+
+// TestMaintainGridFewerLevels checks that orders on levels that where removed from the config are cancelled in
+// active mode, and kept in dry-run mode
+func TestMaintainGridFewerLevels(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		activeMode bool
+		canceled   []string
+		levels     []int
+	}{
+		{name: "active", activeMode: true, canceled: []string{"sell-8"}, levels: []int{0, 2}},
+		{name: "dry-run", activeMode: false, levels: []int{0, 2, 8}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exchange := newFakeExchange()
+			bh := newTestHandler(t, BvvConfig{ActiveMode: test.activeMode}, exchange,
+				map[string]string{"ADA-EUR": "0.5"})
+			market := newTestMarket(t, bh, "ADA", "100")
+			bh.state.Grid[market.Name()] = map[int]gridLevel{
+				0: {Side: "buy", OrderId: "buy-0"},
+				2: {Side: "sell", OrderId: "sell-2"},
+				8: {Side: "sell", OrderId: "sell-8"},
+			}
+			for id, side := range map[string]string{"buy-0": "buy", "sell-2": "sell", "sell-8": "sell"} {
+				exchange.addOrder(bitvavo.Order{OrderId: id, Market: market.Name(), Side: side, Status: "new",
+					OrderType: orderTypeLimit})
+			}
+			config := bvvGridConfig{Low: decimal.RequireFromString("0.4"), High: decimal.RequireFromString("0.6"),
+				Levels: 3, Amount: decimal.NewFromInt(20)}
+			if err := bh.maintainGrid(market, config); err != nil {
+				t.Fatalf("could not maintain grid: %v", err)
+			}
+			if len(exchange.canceled) != len(test.canceled) {
+				t.Fatalf("expected %v to be canceled, got %v", test.canceled, exchange.canceled)
+			}
+			for i, id := range test.canceled {
+				if exchange.canceled[i] != id {
+					t.Errorf("expected %s to be canceled, got %s", id, exchange.canceled[i])
+				}
+			}
+			levels := bh.state.Grid[market.Name()]
+			if len(levels) != len(test.levels) {
+				t.Fatalf("expected levels %v, got %v", test.levels, levels)
+			}
+			for _, level := range test.levels {
+				if _, exists := levels[level]; !exists {
+					t.Errorf("expected level %d to be kept, got %v", level, levels)
+				}
+			}
+			if len(exchange.placed) != 0 {
+				t.Errorf("expected no new orders, got %v", exchange.placed)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"log"
+
+	"github.com/shopspring/decimal"
+)
+
+// minMaxStrategy sells everything above max and buys up to min, unless the market is under water
+type minMaxStrategy struct {
+	buyUnderwater bool
+}
+
+func newMinMaxStrategy(bh *BvvHandler, config bvvMarketConfig) (Strategy, error) {
+	return minMaxStrategy{
+		buyUnderwater: config.BuyUnderwater || bh.config.BuyUnderwater,
+	}, nil
+}
+
+func (mms minMaxStrategy) Evaluate(market BvvMarket) (orders []PlannedOrder, err error) {
+	if market.Max.GreaterThan(decimal.Zero) && market.Max.LessThan(market.Projected()) {
+		return []PlannedOrder{{Side: "sell", Amount: market.Projected().Sub(market.Max), Reason: "above max"}}, nil
+	} else if avgRate, err := market.rate.Average(); err != nil {
+		log.Printf("Could not determine average rate from market %s", market.Name())
+	} else if avgRate.GreaterThan(market.sellPrice()) && !mms.buyUnderwater {
+		// Selling at the current price, after the fee, would not pay back what was paid for it
+		log.Printf("market %s is %s%% under water (%s>%s)", market.Name(),
+			decimalPercent(avgRate, market.sellPrice()), avgRate, market.sellPrice())
+	} else if market.Min.GreaterThan(decimal.Zero) && market.Min.GreaterThan(market.Projected()) {
+		return []PlannedOrder{{Side: "buy", Amount: market.Min.Sub(market.Projected()), Reason: "below min"}}, nil
+	}
+	return nil, nil
+}
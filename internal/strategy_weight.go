@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// weightStrategy keeps the value of a market at a percentage of the portfolio. The portfolio is the fiat balance and
+// the balances of all assets of configured markets, valued in fiat. When the weight of the market drifts more than
+// tolerance away from targetWeight, it is bought or sold back to targetWeight.
+type weightStrategy struct {
+	handler   *BvvHandler
+	target    decimal.Decimal
+	tolerance decimal.Decimal
+}
+
+func newWeightStrategy(bh *BvvHandler, config bvvMarketConfig) (Strategy, error) {
+	if !config.TargetWeight.GreaterThan(decimal.Zero) {
+		return nil, fmt.Errorf("strategy weight requires targetWeight to be set")
+	}
+	total := decimal.Zero
+	for _, marketConfig := range bh.config.Markets {
+		total = total.Add(marketConfig.TargetWeight)
+	}
+	if total.GreaterThan(decimal.NewFromInt(100)) {
+		return nil, fmt.Errorf("targetWeight of all markets adds up to %s%%, which is more than 100%%", total)
+	}
+	return weightStrategy{handler: bh, target: config.TargetWeight, tolerance: config.Tolerance}, nil
+}
+
+func (ws weightStrategy) Evaluate(market BvvMarket) (orders []PlannedOrder, err error) {
+	portfolio, err := ws.handler.portfolioValue()
+	if err != nil || !portfolio.GreaterThan(decimal.Zero) {
+		return nil, err
+	}
+	price, err := market.fiatPrice()
+	if err != nil {
+		return nil, err
+	}
+	hundred := decimal.NewFromInt(100)
+	value := market.Projected().Mul(price)
+	weight := value.Div(portfolio).Mul(hundred)
+	if weight.Sub(ws.target).Abs().LessThanOrEqual(ws.tolerance) {
+		return nil, nil
+	}
+	difference := portfolio.Mul(ws.target).Div(hundred).Sub(value)
+	reason := fmt.Sprintf("weight %s%% is outside %s%% ± %s%%", weight.Round(2), ws.target, ws.tolerance)
+	if difference.GreaterThan(decimal.Zero) {
+		return []PlannedOrder{{Side: "buy", Amount: difference.Div(price), Reason: reason}}, nil
+	}
+	return []PlannedOrder{{Side: "sell", Amount: difference.Neg().Div(price), Reason: reason}}, nil
+}
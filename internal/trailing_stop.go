@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"log"
+
+	"github.com/shopspring/decimal"
+)
+
+// trailingHigh is the highest price of a market since the position was entered
+type trailingHigh struct {
+	High  decimal.Decimal `yaml:"high"`
+	Since int             `yaml:"since"`
+}
+
+// applyTrailingStop holds back the sell orders of a strategy while the price is rising, so the position can ride the
+// trend. They are placed once the price drops trailingStop percent below the highest price since the position was
+// entered. The high starts at the average rate of the position (the entry), and is followed on every run while there
+// is a position, also when the strategy does not want to sell. It starts over after the sells are placed.
+func (bh BvvHandler) applyTrailingStop(market BvvMarket, orders []PlannedOrder) (filtered []PlannedOrder, err error) {
+	config := market.config.TrailingStop
+	if !config.Enabled() {
+		return orders, nil
+	}
+	trailing, exists := bh.state.Trailing[market.Name()]
+	if market.Total().LessThan(market.MinimumAmount()) {
+		if exists {
+			log.Printf("%s: no longer trailing, position is closed", market.Name())
+			delete(bh.state.Trailing, market.Name())
+			return orders, bh.state.save()
+		}
+		return orders, nil
+	}
+	if !exists {
+		if entry, err := market.rate.Average(); err == nil && entry.GreaterThan(decimal.Zero) {
+			trailing.High = entry
+		}
+		if now, err := bh.connection.Time(); err == nil {
+			trailing.Since = now.Time
+		}
+	}
+	if market.Price.GreaterThan(trailing.High) {
+		trailing.High = market.Price
+	}
+	if !exists || !trailing.High.Equal(bh.state.Trailing[market.Name()].High) {
+		bh.state.Trailing[market.Name()] = trailing
+		if err = bh.state.save(); err != nil {
+			return orders, err
+		}
+	}
+	var sells []PlannedOrder
+	for _, order := range orders {
+		if order.Side == "sell" {
+			sells = append(sells, order)
+		} else {
+			filtered = append(filtered, order)
+		}
+	}
+	if len(sells) == 0 {
+		return filtered, nil
+	}
+	stop := trailing.High.Mul(decimal.NewFromInt(1).Sub(config.Percent.Div(decimal.NewFromInt(100))))
+	if market.Price.GreaterThan(stop) {
+		log.Printf("%s: trailing, high is %s, selling below %s", market.Name(), trailing.High, stop.Round(5))
+		return filtered, nil
+	}
+	log.Printf("%s: price %s dropped below trailing stop %s (high %s)", market.Name(), market.Price, stop.Round(5),
+		trailing.High)
+	delete(bh.state.Trailing, market.Name())
+	return append(filtered, sells...), bh.state.save()
+}
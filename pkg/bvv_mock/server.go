@@ -0,0 +1,367 @@
+package bvv_mock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * This is a stand-in for the Bitvavo REST API which can be used to run bvv_moneymaker without network.
+ * Responses are scripted with fixture files, where the file name is derived from the endpoint:
+ * `/ticker/price` is served from `ticker_price.json`, `/BTC-EUR/candles` from `BTC-EUR_candles.json`, etc.
+ * Posted orders are not read from fixtures, but recorded, so a test can assert which orders where placed.
+ * They can be retrieved with GET /order and GET /orders, and are filled right away, except for stop loss and take
+ * profit orders which are awaiting a trigger until they are canceled.
+ */
+
+const apiPrefix = "/v2"
+
+// These endpoints require a valid signature
+var privateEndpoints = map[string]bool{
+	"/balance":    true,
+	"/trades":     true,
+	"/order":      true,
+	"/orders":     true,
+	"/ordersOpen": true,
+	"/account":    true,
+}
+
+type mockError struct {
+	Code    int    `json:"errorCode"`
+	Message string `json:"error"`
+}
+
+type PostedOrders []PostedOrder
+
+// PostedOrder holds the body of a POST /order request
+type PostedOrder map[string]string
+
+type Server struct {
+	fixtures  string
+	key       string
+	secret    string
+	mutex     sync.Mutex
+	orders    PostedOrders
+	placed    map[string]map[string]interface{}
+	orderLog  io.Writer
+	lastOrder int
+}
+
+// NewServer returns a Server serving fixtures from a folder and verifying signatures with key and secret
+func NewServer(fixtures string, key string, secret string) *Server {
+	return &Server{
+		fixtures: fixtures,
+		key:      key,
+		secret:   secret,
+		placed:   make(map[string]map[string]interface{}),
+	}
+}
+
+// SetOrderLog can be used to write every posted order as a json line to a writer (e.g. a file)
+func (s *Server) SetOrderLog(w io.Writer) {
+	s.orderLog = w
+}
+
+// Orders returns all orders that where posted so far
+func (s *Server) Orders() PostedOrders {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	orders := make(PostedOrders, len(s.orders))
+	copy(orders, s.orders)
+	return orders
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, 107, err.Error())
+		return
+	}
+	if r.Header.Get("Bitvavo-Access-Key") != "" || privateEndpoints[endpoint] {
+		if err = s.checkSignature(r, endpoint, body); err != nil {
+			s.writeError(w, http.StatusForbidden, 309, err.Error())
+			return
+		}
+	}
+	switch {
+	case endpoint == "/time":
+		s.writeJSON(w, map[string]int64{"time": time.Now().UnixNano() / int64(time.Millisecond)})
+	case endpoint == "/order" && r.Method == http.MethodPost:
+		s.placeOrder(w, body)
+	case endpoint == "/order" && r.Method == http.MethodGet:
+		s.getOrder(w, r)
+	case endpoint == "/order" && r.Method == http.MethodPut:
+		s.updateOrder(w, body)
+	case endpoint == "/order" && r.Method == http.MethodDelete:
+		s.cancelOrder(w, r)
+	case endpoint == "/orders" && r.Method == http.MethodGet:
+		s.getOrders(w, r)
+	case endpoint == "/orders" && r.Method == http.MethodDelete:
+		s.cancelOrders(w, r)
+	case r.Method == http.MethodGet:
+		s.serveFixture(w, r, endpoint)
+	default:
+		s.writeError(w, http.StatusNotFound, 110, fmt.Sprintf("no mock for %s %s", r.Method, endpoint))
+	}
+}
+
+// checkSignature validates the signature headers the same way Bitvavo does
+func (s *Server) checkSignature(r *http.Request, endpoint string, body []byte) error {
+	if r.Header.Get("Bitvavo-Access-Key") != s.key {
+		return fmt.Errorf("invalid Bitvavo-Access-Key")
+	}
+	timestamp := r.Header.Get("Bitvavo-Access-Timestamp")
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		return fmt.Errorf("invalid Bitvavo-Access-Timestamp %s", timestamp)
+	}
+	message := timestamp + r.Method + apiPrefix + endpoint
+	if r.URL.RawQuery != "" {
+		message += "?" + r.URL.RawQuery
+	}
+	message += string(body)
+	h := hmac.New(sha256.New, []byte(s.secret))
+	h.Write([]byte(message))
+	expected := hex.EncodeToString(h.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("Bitvavo-Access-Signature"))) {
+		return fmt.Errorf("invalid Bitvavo-Access-Signature")
+	}
+	return nil
+}
+
+// fixtureFile converts an endpoint like /BTC-EUR/candles into a path like <fixtures>/BTC-EUR_candles.json
+func (s *Server) fixtureFile(endpoint string) string {
+	name := strings.ReplaceAll(strings.Trim(endpoint, "/"), "/", "_")
+	return filepath.Join(s.fixtures, filepath.Base(name)+".json")
+}
+
+func (s *Server) serveFixture(w http.ResponseWriter, r *http.Request, endpoint string) {
+	// Fixtures are read from a folder which is specified by the operator of the mock
+	// #nosec
+	data, err := ioutil.ReadFile(s.fixtureFile(endpoint))
+	if os.IsNotExist(err) {
+		s.writeError(w, http.StatusNotFound, 110, fmt.Sprintf("no fixture for %s", endpoint))
+		return
+	} else if err != nil {
+		s.writeError(w, http.StatusInternalServerError, 101, err.Error())
+		return
+	}
+	var fixture interface{}
+	if err = json.Unmarshal(data, &fixture); err != nil {
+		s.writeError(w, http.StatusInternalServerError, 101, err.Error())
+		return
+	}
+	if list, ok := fixture.([]interface{}); ok {
+		fixture = filterList(list, r)
+	}
+	s.writeJSON(w, fixture)
+}
+
+// filterList applies the `market` / `symbol` and `limit` options to a list fixture
+func filterList(list []interface{}, r *http.Request) []interface{} {
+	query := r.URL.Query()
+	filtered := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		if obj, ok := item.(map[string]interface{}); ok {
+			if market := query.Get("market"); market != "" && obj["market"] != nil && obj["market"] != market {
+				continue
+			}
+			if symbol := query.Get("symbol"); symbol != "" && obj["symbol"] != nil && obj["symbol"] != symbol {
+				continue
+			}
+		}
+		filtered = append(filtered, item)
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit >= 0 && limit < len(filtered) {
+		filtered = filtered[:limit]
+	}
+	return filtered
+}
+
+// mockOrderId returns the id of the n-th placed order
+func mockOrderId(n int) string {
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
+}
+
+func (s *Server) placeOrder(w http.ResponseWriter, body []byte) {
+	var order PostedOrder
+	if err := json.Unmarshal(body, &order); err != nil {
+		s.writeError(w, http.StatusBadRequest, 107, err.Error())
+		return
+	}
+	for _, key := range []string{"market", "side", "orderType"} {
+		if order[key] == "" {
+			s.writeError(w, http.StatusBadRequest, 203, fmt.Sprintf("%s parameter is required", key))
+			return
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastOrder++
+	orderId := mockOrderId(s.lastOrder)
+	s.orders = append(s.orders, order)
+	if s.orderLog != nil {
+		if line, err := json.Marshal(order); err == nil {
+			_, _ = s.orderLog.Write(append(line, '\n'))
+		}
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	placed := map[string]interface{}{
+		"orderId":         orderId,
+		"market":          order["market"],
+		"created":         now,
+		"updated":         now,
+		"status":          "filled",
+		"side":            order["side"],
+		"orderType":       order["orderType"],
+		"amount":          order["amount"],
+		"amountRemaining": "0",
+		"filledAmount":    order["amount"],
+		"price":           order["price"],
+		"timeInForce":     order["timeInForce"],
+	}
+	if clientOrderId, exists := order["clientOrderId"]; exists {
+		placed["clientOrderId"] = clientOrderId
+	}
+	if triggerAmount, triggered := order["triggerAmount"]; triggered {
+		placed["status"] = "awaitingTrigger"
+		placed["amountRemaining"] = order["amount"]
+		placed["filledAmount"] = "0"
+		placed["triggerAmount"] = triggerAmount
+		placed["triggerPrice"] = triggerAmount
+		placed["triggerType"] = order["triggerType"]
+		placed["triggerReference"] = order["triggerReference"]
+	}
+	s.placed[orderId] = placed
+	s.writeJSON(w, placed)
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	order, found := s.placed[query.Get("orderId")]
+	if !found || order["market"] != query.Get("market") {
+		s.writeError(w, http.StatusNotFound, 240, "No order found. Please be aware that simultaneously updating "+
+			"the same order may return this error.")
+		return
+	}
+	s.writeJSON(w, order)
+}
+
+// getOrders returns the placed orders of a market, newest first
+func (s *Server) getOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	start, _ := strconv.ParseInt(query.Get("start"), 10, 64)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	orders := make([]interface{}, 0, len(s.placed))
+	for i := s.lastOrder; i > 0; i-- {
+		order, found := s.placed[mockOrderId(i)]
+		if found && order["market"] == query.Get("market") && order["created"].(int64) >= start {
+			orders = append(orders, order)
+		}
+	}
+	s.writeJSON(w, filterList(orders, r))
+}
+
+// updateOrder changes an order that was placed before, or echoes the update as an order
+func (s *Server) updateOrder(w http.ResponseWriter, body []byte) {
+	var order PostedOrder
+	if err := json.Unmarshal(body, &order); err != nil {
+		s.writeError(w, http.StatusBadRequest, 107, err.Error())
+		return
+	}
+	for _, key := range []string{"market", "orderId"} {
+		if order[key] == "" {
+			s.writeError(w, http.StatusBadRequest, 203, fmt.Sprintf("%s parameter is required", key))
+			return
+		}
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if placed, found := s.placed[order["orderId"]]; found {
+		for key, value := range order {
+			placed[key] = value
+		}
+		if order["amount"] != "" && placed["status"] != "filled" {
+			placed["amountRemaining"] = order["amount"]
+		}
+		placed["updated"] = now
+		s.writeJSON(w, placed)
+		return
+	}
+	s.writeJSON(w, map[string]interface{}{
+		"orderId":     order["orderId"],
+		"market":      order["market"],
+		"updated":     now,
+		"status":      "new",
+		"amount":      order["amount"],
+		"price":       order["price"],
+		"timeInForce": order["timeInForce"],
+	})
+}
+
+func (s *Server) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	for _, key := range []string{"market", "orderId"} {
+		if query.Get(key) == "" {
+			s.writeError(w, http.StatusBadRequest, 203, fmt.Sprintf("%s parameter is required", key))
+			return
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if placed, found := s.placed[query.Get("orderId")]; found {
+		placed["status"] = "canceled"
+	}
+	s.writeJSON(w, map[string]string{"orderId": query.Get("orderId")})
+}
+
+// cancelOrders cancels all placed orders (of a market) which are not filled yet
+func (s *Server) cancelOrders(w http.ResponseWriter, r *http.Request) {
+	market := r.URL.Query().Get("market")
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	canceled := make([]map[string]string, 0)
+	for i := 1; i <= s.lastOrder; i++ {
+		orderId := mockOrderId(i)
+		placed, found := s.placed[orderId]
+		if !found || (market != "" && placed["market"] != market) {
+			continue
+		}
+		if status := placed["status"]; status == "filled" || status == "canceled" {
+			continue
+		}
+		placed["status"] = "canceled"
+		canceled = append(canceled, map[string]string{"orderId": orderId})
+	}
+	s.writeJSON(w, canceled)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(mockError{Code: code, Message: message})
+}
@@ -0,0 +1,79 @@
+package moving_average
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/shopspring/decimal"
+)
+
+type BollingerValue struct {
+	Lower  decimal.Decimal
+	Middle decimal.Decimal
+	Upper  decimal.Decimal
+}
+
+// BollingerBands are a simple moving average, with bands at a number of standard deviations below and above
+type BollingerBands struct {
+	window     int
+	deviations float64
+	values     []float64
+}
+
+func NewBollingerBands(window int, deviations float64) (bb *BollingerBands, err error) {
+	if window < 2 {
+		return bb, MAError{
+			fmt.Errorf("invalid window size %d", window),
+		}
+	}
+	if deviations <= 0 {
+		return bb, MAError{
+			fmt.Errorf("invalid number of standard deviations %f", deviations),
+		}
+	}
+	return &BollingerBands{window: window, deviations: deviations}, nil
+}
+
+func (bb *BollingerBands) AddValue(value decimal.Decimal) {
+	fValue, _ := value.Float64()
+	bb.values = append(bb.values, fValue)
+	if len(bb.values) > bb.window {
+		bb.values = bb.values[1:]
+	}
+}
+
+func (bb BollingerBands) Get() (value BollingerValue, err error) {
+	if !bb.Ready() {
+		return value, MAError{
+			fmt.Errorf("cannot get Bollinger Bands with %d of %d values", len(bb.values), bb.window),
+		}
+	}
+	var sum, squares float64
+	for _, v := range bb.values {
+		sum += v
+	}
+	mean := sum / float64(len(bb.values))
+	for _, v := range bb.values {
+		squares += (v - mean) * (v - mean)
+	}
+	band := bb.deviations * math.Sqrt(squares/float64(len(bb.values)))
+	return BollingerValue{
+		Lower:  decimal.NewFromFloat(mean - band),
+		Middle: decimal.NewFromFloat(mean),
+		Upper:  decimal.NewFromFloat(mean + band),
+	}, nil
+}
+
+// Value returns the middle band
+func (bb BollingerBands) Value() (value decimal.Decimal, err error) {
+	bands, err := bb.Get()
+	return bands.Middle, err
+}
+
+func (bb BollingerBands) Ready() bool {
+	return len(bb.values) >= bb.window
+}
+
+func (bb *BollingerBands) Reset() {
+	bb.values = nil
+}
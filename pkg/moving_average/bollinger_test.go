@@ -0,0 +1,51 @@
+package moving_average
+
+import (
+	"testing"
+)
+
+func TestBollingerBands(t *testing.T) {
+	for _, test := range []struct {
+		name                 string
+		window               int
+		deviations           float64
+		values               []string
+		lower, middle, upper string
+	}{
+		{name: "not ready", window: 3, deviations: 2, values: []string{"1", "3"}},
+		{name: "flat", window: 2, deviations: 2, values: []string{"4", "4"}, lower: "4", middle: "4", upper: "4"},
+		{name: "window", window: 2, deviations: 2, values: []string{"1", "3"}, lower: "0", middle: "2", upper: "4"},
+		{name: "sliding", window: 2, deviations: 1, values: []string{"1", "3", "5"}, lower: "3", middle: "4",
+			upper: "5"},
+		{name: "population deviation", window: 8, deviations: 2,
+			values: []string{"2", "4", "4", "4", "5", "5", "7", "9"}, lower: "1", middle: "5", upper: "9"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			bb, err := NewBollingerBands(test.window, test.deviations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addValues(t, bb, test.values)
+			value, err := bb.Get()
+			if test.middle == "" {
+				if err == nil || bb.Ready() {
+					t.Errorf("expected Bollinger Bands not to be ready, got %v", value)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("could not get Bollinger Bands: %v", err)
+			}
+			expectValue(t, "lower", value.Lower, test.lower)
+			expectValue(t, "middle", value.Middle, test.middle)
+			expectValue(t, "upper", value.Upper, test.upper)
+		})
+	}
+	for _, test := range []struct {
+		window     int
+		deviations float64
+	}{{1, 2}, {20, 0}} {
+		if _, err := NewBollingerBands(test.window, test.deviations); err == nil {
+			t.Errorf("expected an error for window %d with %f deviations", test.window, test.deviations)
+		}
+	}
+}
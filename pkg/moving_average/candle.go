@@ -0,0 +1,192 @@
+package moving_average
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Candle holds all values of a time bucket, for indicators which need more than one value per bucket
+type Candle struct {
+	Open   decimal.Decimal
+	High   decimal.Decimal
+	Low    decimal.Decimal
+	Close  decimal.Decimal
+	Volume decimal.Decimal
+}
+
+// flatCandle is used when a CandleIndicator only gets a value (through AddValue)
+func flatCandle(value decimal.Decimal) Candle {
+	return Candle{Open: value, High: value, Low: value, Close: value}
+}
+
+// CandleIndicator is implemented by indicators which use high, low and volume as well
+type CandleIndicator interface {
+	Indicator
+	AddCandle(candle Candle)
+}
+
+// VWAP is the Volume Weighted Average Price of the typical price ((high + low + close) / 3) over a window
+type VWAP struct {
+	window  int
+	candles []Candle
+}
+
+func NewVWAP(window int) (vwap *VWAP, err error) {
+	if window < 1 {
+		return vwap, MAError{
+			fmt.Errorf("invalid window size %d", window),
+		}
+	}
+	return &VWAP{window: window}, nil
+}
+
+func (vwap *VWAP) AddCandle(candle Candle) {
+	vwap.candles = append(vwap.candles, candle)
+	if len(vwap.candles) > vwap.window {
+		vwap.candles = vwap.candles[1:]
+	}
+}
+
+// AddValue adds a candle without volume
+func (vwap *VWAP) AddValue(value decimal.Decimal) {
+	vwap.AddCandle(flatCandle(value))
+}
+
+func (vwap VWAP) Value() (value decimal.Decimal, err error) {
+	var volume decimal.Decimal
+	three := decimal.NewFromInt(3)
+	for _, c := range vwap.candles {
+		typical := c.High.Add(c.Low).Add(c.Close).Div(three)
+		value = value.Add(typical.Mul(c.Volume))
+		volume = volume.Add(c.Volume)
+	}
+	if !volume.GreaterThan(decimal.Zero) {
+		return decimal.Zero, MAError{
+			fmt.Errorf("cannot get VWAP without volume"),
+		}
+	}
+	return value.Div(volume), nil
+}
+
+func (vwap VWAP) Ready() bool {
+	return len(vwap.candles) >= vwap.window
+}
+
+func (vwap *VWAP) Reset() {
+	vwap.candles = nil
+}
+
+// ATR is the Average True Range with Wilder's smoothing
+type ATR struct {
+	window    int
+	count     int
+	prevClose decimal.Decimal
+	atr       decimal.Decimal
+}
+
+func NewATR(window int) (atr *ATR, err error) {
+	if window < 1 {
+		return atr, MAError{
+			fmt.Errorf("invalid window size %d", window),
+		}
+	}
+	return &ATR{window: window}, nil
+}
+
+func (atr *ATR) AddCandle(candle Candle) {
+	trueRange := candle.High.Sub(candle.Low)
+	if atr.count > 0 {
+		trueRange = decimal.Max(trueRange, candle.High.Sub(atr.prevClose).Abs(), candle.Low.Sub(atr.prevClose).Abs())
+	}
+	atr.count += 1
+	atr.prevClose = candle.Close
+	window := decimal.NewFromInt(int64(atr.window))
+	if atr.count <= atr.window {
+		// Seed with the average of the first window true ranges
+		atr.atr = atr.atr.Add(trueRange.Sub(atr.atr).Div(decimal.NewFromInt(int64(atr.count))))
+	} else {
+		atr.atr = atr.atr.Mul(window.Sub(decimal.NewFromInt(1))).Add(trueRange).Div(window)
+	}
+}
+
+// AddValue adds a candle where open, high, low and close are all value
+func (atr *ATR) AddValue(value decimal.Decimal) {
+	atr.AddCandle(flatCandle(value))
+}
+
+func (atr ATR) Value() (value decimal.Decimal, err error) {
+	if !atr.Ready() {
+		return value, MAError{
+			fmt.Errorf("cannot get ATR with %d of %d values", atr.count, atr.window),
+		}
+	}
+	return atr.atr, nil
+}
+
+func (atr ATR) Ready() bool {
+	return atr.count >= atr.window
+}
+
+func (atr *ATR) Reset() {
+	*atr = ATR{window: atr.window}
+}
+
+// GetPercent returns the ATR as a percentage of a price
+func (atr ATR) GetPercent(price decimal.Decimal) (percent decimal.Decimal, err error) {
+	value, err := atr.Value()
+	if err != nil {
+		return percent, err
+	}
+	if price.Equal(decimal.Zero) {
+		return percent, MAError{
+			fmt.Errorf("cannot get ATR percent for price 0"),
+		}
+	}
+	return value.Div(price).Mul(decimal.NewFromInt(100)), nil
+}
+
+// OBV is the On-Balance Volume: the volume is added when the close goes up, and subtracted when it goes down
+type OBV struct {
+	count     int
+	prevClose decimal.Decimal
+	obv       decimal.Decimal
+}
+
+func NewOBV() *OBV {
+	return &OBV{}
+}
+
+func (obv *OBV) AddCandle(candle Candle) {
+	if obv.count > 0 {
+		if candle.Close.GreaterThan(obv.prevClose) {
+			obv.obv = obv.obv.Add(candle.Volume)
+		} else if candle.Close.LessThan(obv.prevClose) {
+			obv.obv = obv.obv.Sub(candle.Volume)
+		}
+	}
+	obv.count += 1
+	obv.prevClose = candle.Close
+}
+
+// AddValue adds a candle without volume
+func (obv *OBV) AddValue(value decimal.Decimal) {
+	obv.AddCandle(flatCandle(value))
+}
+
+func (obv OBV) Value() (value decimal.Decimal, err error) {
+	if !obv.Ready() {
+		return value, MAError{
+			fmt.Errorf("cannot get OBV without at least 2 values"),
+		}
+	}
+	return obv.obv, nil
+}
+
+func (obv OBV) Ready() bool {
+	return obv.count > 1
+}
+
+func (obv *OBV) Reset() {
+	*obv = OBV{}
+}
@@ -0,0 +1,97 @@
+package moving_average
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// newCandle returns a candle with high, low, close and volume
+func newCandle(high, low, close, volume string) Candle {
+	return Candle{
+		Open:   decimal.RequireFromString(close),
+		High:   decimal.RequireFromString(high),
+		Low:    decimal.RequireFromString(low),
+		Close:  decimal.RequireFromString(close),
+		Volume: decimal.RequireFromString(volume),
+	}
+}
+
+// testCandles are candles with a gap up in the last one
+var testCandles = []Candle{
+	newCandle("10", "8", "9", "1"),
+	newCandle("12", "9", "11", "3"),
+	newCandle("11", "7", "8", "4"),
+	newCandle("15", "14", "14", "2"),
+}
+
+func TestCandleIndicators(t *testing.T) {
+	vwap, err := NewVWAP(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atr, err := NewATR(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name      string
+		indicator CandleIndicator
+		expected  []string
+	}{
+		// typical prices are 9, 10.6667, 8.6667 and 14.3333
+		{name: "VWAP", indicator: vwap, expected: []string{"", "10.25", "9.5238", "10.5556"}},
+		// true ranges are 2, 3, 4 and 7
+		{name: "ATR", indicator: atr, expected: []string{"", "2.5", "3.25", "5.125"}},
+		{name: "OBV", indicator: NewOBV(), expected: []string{"", "3", "-1", "1"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for i, candle := range testCandles {
+				test.indicator.AddCandle(candle)
+				value, err := test.indicator.Value()
+				if test.expected[i] == "" {
+					if test.indicator.Ready() {
+						t.Errorf("candle %d: expected %s not to be ready, got %s", i, test.name, value)
+					}
+					continue
+				} else if err != nil {
+					t.Fatalf("candle %d: could not get %s: %v", i, test.name, err)
+				}
+				expectValue(t, test.name, value, test.expected[i])
+			}
+			test.indicator.Reset()
+			if test.indicator.Ready() {
+				t.Errorf("expected %s not to be ready after a reset", test.name)
+			}
+		})
+	}
+}
+
+func TestVWAPWithoutVolume(t *testing.T) {
+	vwap, err := NewVWAP(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addValues(t, vwap, []string{"1", "2"})
+	if value, err := vwap.Value(); err == nil {
+		t.Errorf("expected an error without volume, got %s", value)
+	}
+}
+
+func TestATRPercent(t *testing.T) {
+	atr, err := NewATR(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, candle := range testCandles[:3] {
+		atr.AddCandle(candle)
+	}
+	percent, err := atr.GetPercent(decimal.NewFromInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, "ATR percent", percent, "32.5")
+	if _, err = atr.GetPercent(decimal.Zero); err == nil {
+		t.Errorf("expected an error for price 0")
+	}
+}
@@ -37,15 +37,16 @@ func (av EMAAvgVal) Get() (value float64, err error) {
 	return av.sum / float64(av.count), nil
 }
 
-// EMA is calculated with historic values only and therefore will on average be lower than the current value.
-// Therefore, we also track the average offset so we can better predict the current expected EMA.
-
 type EMAHistVals []EMAHistVal
 type EMAHistVal struct {
 	abs decimal.Decimal
 	exp float64
 }
 
+// EMA is a simple moving average of the logarithm of the values (configured as "logsma"), which is not an
+// exponentially weighted average (see ExponentialMovingAverage for that). It is calculated with historic values only,
+// and therefore will on average be lower than the current value, so we also track the average offset to better
+// predict the current expected EMA.
 type EMA struct {
 	value   EMAAvgVal
 	offset  EMAAvgVal
@@ -117,3 +118,16 @@ func (ema EMA) GetBandwidth() (bw MABandwidth, err error) {
 	bw.Cur, err = ema.GetWithOffset()
 	return bw, err
 }
+
+func (ema EMA) Value() (decimal.Decimal, error) {
+	return ema.GetWithOffset()
+}
+
+// Ready returns true when there is at least one offset, which needs window values
+func (ema EMA) Ready() bool {
+	return ema.offset.count > 0
+}
+
+func (ema *EMA) Reset() {
+	*ema = EMA{window: ema.window}
+}
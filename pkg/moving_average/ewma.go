@@ -0,0 +1,105 @@
+package moving_average
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+const DefaultSmoothing = 2.0
+
+// ExponentialMovingAverage is a real exponentially weighted moving average, like charting sites show.
+// The first span values are averaged (SMA) to seed the EMA, after that every value is weighted with
+// alpha = smoothing / (1 + span).
+type ExponentialMovingAverage struct {
+	alpha   float64
+	span    int
+	count   int
+	value   float64
+	history []decimal.Decimal
+}
+
+func NewExponentialMovingAverage(span int, smoothing float64) (ema *ExponentialMovingAverage, err error) {
+	if span < 1 {
+		return ema, MAError{
+			fmt.Errorf("invalid span %d", span),
+		}
+	}
+	if smoothing <= 0 {
+		smoothing = DefaultSmoothing
+	}
+	alpha := smoothing / float64(1+span)
+	if alpha > 1 {
+		return ema, MAError{
+			fmt.Errorf("invalid smoothing factor %f for span %d", smoothing, span),
+		}
+	}
+	return &ExponentialMovingAverage{alpha: alpha, span: span}, nil
+}
+
+func (ema *ExponentialMovingAverage) AddValue(value decimal.Decimal) {
+	fValue, _ := value.Float64()
+	ema.count += 1
+	if ema.count <= ema.span {
+		// Seed with a simple moving average
+		ema.value += (fValue - ema.value) / float64(ema.count)
+	} else {
+		ema.value += ema.alpha * (fValue - ema.value)
+	}
+	ema.history = append(ema.history, value)
+	if len(ema.history) > ema.span {
+		ema.history = ema.history[1:]
+	}
+}
+
+func (ema ExponentialMovingAverage) Get() (value float64, err error) {
+	if ema.count < 1 {
+		return value, MAError{
+			fmt.Errorf("cannot get EMA without values"),
+		}
+	}
+	return ema.value, nil
+}
+
+// GetWithOffset returns the EMA. A real EMA follows the price closely enough, so there is no offset to correct for.
+func (ema ExponentialMovingAverage) GetWithOffset() (ret decimal.Decimal, err error) {
+	fValue, err := ema.Get()
+	if err != nil {
+		return ret, err
+	}
+	return decimal.NewFromFloat(fValue), nil
+}
+
+// GetBandwidth returns the lowest and highest value of the last span values, and the EMA as current
+func (ema ExponentialMovingAverage) GetBandwidth() (bw MABandwidth, err error) {
+	if len(ema.history) < 1 {
+		return bw, MAError{
+			fmt.Errorf("cannot get bandwidth without history"),
+		}
+	}
+	bw.Min = ema.history[0]
+	bw.Max = ema.history[0]
+	for _, val := range ema.history {
+		if bw.Min.GreaterThan(val) {
+			bw.Min = val
+		}
+		if bw.Max.LessThan(val) {
+			bw.Max = val
+		}
+	}
+	bw.Cur, err = ema.GetWithOffset()
+	return bw, err
+}
+
+func (ema ExponentialMovingAverage) Value() (decimal.Decimal, error) {
+	return ema.GetWithOffset()
+}
+
+// Ready returns true when the EMA is seeded
+func (ema ExponentialMovingAverage) Ready() bool {
+	return ema.count >= ema.span
+}
+
+func (ema *ExponentialMovingAverage) Reset() {
+	*ema = ExponentialMovingAverage{alpha: ema.alpha, span: ema.span}
+}
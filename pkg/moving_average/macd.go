@@ -0,0 +1,102 @@
+package moving_average
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+type MACDValue struct {
+	MACD      decimal.Decimal
+	Signal    decimal.Decimal
+	Histogram decimal.Decimal
+}
+
+// MACD is the difference between a fast and a slow EMA, with an EMA of that difference as signal line
+type MACD struct {
+	fast   *ExponentialMovingAverage
+	slow   *ExponentialMovingAverage
+	signal *ExponentialMovingAverage
+	spans  [3]int
+	count  int
+}
+
+func NewMACD(fast int, slow int, signal int) (macd *MACD, err error) {
+	if fast >= slow {
+		return macd, MAError{
+			fmt.Errorf("fast span %d should be smaller than slow span %d", fast, slow),
+		}
+	}
+	macd = &MACD{spans: [3]int{fast, slow, signal}}
+	if macd.fast, err = NewExponentialMovingAverage(fast, DefaultSmoothing); err != nil {
+		return nil, err
+	}
+	if macd.slow, err = NewExponentialMovingAverage(slow, DefaultSmoothing); err != nil {
+		return nil, err
+	}
+	if macd.signal, err = NewExponentialMovingAverage(signal, DefaultSmoothing); err != nil {
+		return nil, err
+	}
+	return macd, nil
+}
+
+func (macd *MACD) AddValue(value decimal.Decimal) {
+	macd.count += 1
+	macd.fast.AddValue(value)
+	macd.slow.AddValue(value)
+	// The signal line should only start once the slow EMA is seeded
+	if macd.count < macd.spans[1] {
+		return
+	}
+	line, err := macd.line()
+	if err == nil {
+		macd.signal.AddValue(line)
+	}
+}
+
+func (macd MACD) line() (line decimal.Decimal, err error) {
+	fast, err := macd.fast.GetWithOffset()
+	if err != nil {
+		return line, err
+	}
+	slow, err := macd.slow.GetWithOffset()
+	if err != nil {
+		return line, err
+	}
+	return fast.Sub(slow), nil
+}
+
+// Get returns the MACD line, the signal line and the histogram (MACD - signal)
+func (macd MACD) Get() (value MACDValue, err error) {
+	if !macd.Ready() {
+		return value, MAError{
+			fmt.Errorf("cannot get MACD with %d of %d values", macd.count, macd.spans[1]+macd.spans[2]-1),
+		}
+	}
+	if value.MACD, err = macd.line(); err != nil {
+		return value, err
+	}
+	if value.Signal, err = macd.signal.GetWithOffset(); err != nil {
+		return value, err
+	}
+	value.Histogram = value.MACD.Sub(value.Signal)
+	return value, nil
+}
+
+// Value returns the MACD line
+func (macd MACD) Value() (value decimal.Decimal, err error) {
+	macdValue, err := macd.Get()
+	return macdValue.MACD, err
+}
+
+// Ready returns true when the signal line is seeded
+func (macd MACD) Ready() bool {
+	return macd.count >= macd.spans[1]+macd.spans[2]-1
+}
+
+func (macd *MACD) Reset() {
+	macd.count = 0
+	macd.fast.Reset()
+	macd.slow.Reset()
+	macd.signal.Reset()
+}
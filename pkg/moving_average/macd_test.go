@@ -0,0 +1,44 @@
+package moving_average
+
+import (
+	"testing"
+)
+
+func TestMACD(t *testing.T) {
+	for _, test := range []struct {
+		name                    string
+		values                  []string
+		macd, signal, histogram string
+	}{
+		{name: "not ready", values: []string{"1", "2"}},
+		{name: "flat", values: []string{"5", "5", "5", "5"}, macd: "0", signal: "0", histogram: "0"},
+		{name: "seeded", values: []string{"1", "2", "4"}, macd: "0.8333", signal: "0.6667", histogram: "0.1667"},
+		{name: "rising", values: []string{"1", "2", "4", "8"}, macd: "1.6111", signal: "1.2963",
+			histogram: "0.3148"},
+		{name: "falling", values: []string{"8", "4", "2", "1"}, macd: "-0.7778", signal: "-1.0741",
+			histogram: "0.2963"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			macd, err := NewMACD(1, 2, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addValues(t, macd, test.values)
+			value, err := macd.Get()
+			if test.macd == "" {
+				if err == nil || macd.Ready() {
+					t.Errorf("expected MACD not to be ready, got %v", value)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("could not get MACD: %v", err)
+			}
+			expectValue(t, "MACD", value.MACD, test.macd)
+			expectValue(t, "signal", value.Signal, test.signal)
+			expectValue(t, "histogram", value.Histogram, test.histogram)
+		})
+	}
+	if _, err := NewMACD(26, 12, 9); err == nil {
+		t.Errorf("expected an error for a fast span above the slow span")
+	}
+}
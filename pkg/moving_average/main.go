@@ -6,6 +6,36 @@ type MAError struct {
 	error
 }
 
+// Indicator is implemented by all indicators in this package
+type Indicator interface {
+	AddValue(value decimal.Decimal)
+	// Value returns the main value of the indicator, or an error when it is not ready
+	Value() (decimal.Decimal, error)
+	// Ready returns true when the indicator has seen enough values
+	Ready() bool
+	// Reset forgets all values that where added
+	Reset()
+}
+
+var (
+	_ Indicator       = &SimpleMovingAverage{}
+	_ MovingAverage   = &EMA{}
+	_ MovingAverage   = &ExponentialMovingAverage{}
+	_ Indicator       = &RSI{}
+	_ Indicator       = &MACD{}
+	_ Indicator       = &BollingerBands{}
+	_ CandleIndicator = &VWAP{}
+	_ CandleIndicator = &ATR{}
+	_ CandleIndicator = &OBV{}
+)
+
+// MovingAverage is implemented by moving averages which can predict an expected rate and a bandwidth
+type MovingAverage interface {
+	Indicator
+	GetWithOffset() (decimal.Decimal, error)
+	GetBandwidth() (MABandwidth, error)
+}
+
 type MABandwidth struct {
 	Min decimal.Decimal
 	Cur decimal.Decimal
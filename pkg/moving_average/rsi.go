@@ -0,0 +1,78 @@
+package moving_average
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// RSI is the Relative Strength Index with Wilder's smoothing. The first window changes are averaged to seed
+// the average gain and loss.
+type RSI struct {
+	window  int
+	count   int
+	last    float64
+	avgGain float64
+	avgLoss float64
+}
+
+func NewRSI(window int) (rsi *RSI, err error) {
+	if window < 1 {
+		return rsi, MAError{
+			fmt.Errorf("invalid window size %d", window),
+		}
+	}
+	return &RSI{window: window}, nil
+}
+
+func (rsi *RSI) AddValue(value decimal.Decimal) {
+	fValue, _ := value.Float64()
+	rsi.count += 1
+	if rsi.count == 1 {
+		rsi.last = fValue
+		return
+	}
+	change := fValue - rsi.last
+	rsi.last = fValue
+	var gain, loss float64
+	if change > 0 {
+		gain = change
+	} else {
+		loss = -change
+	}
+	// number of changes we have seen so far
+	changes := rsi.count - 1
+	if changes <= rsi.window {
+		rsi.avgGain += (gain - rsi.avgGain) / float64(changes)
+		rsi.avgLoss += (loss - rsi.avgLoss) / float64(changes)
+	} else {
+		rsi.avgGain = (rsi.avgGain*float64(rsi.window-1) + gain) / float64(rsi.window)
+		rsi.avgLoss = (rsi.avgLoss*float64(rsi.window-1) + loss) / float64(rsi.window)
+	}
+}
+
+// Get returns the RSI, which is between 0 and 100
+func (rsi RSI) Get() (value decimal.Decimal, err error) {
+	if !rsi.Ready() {
+		return value, MAError{
+			fmt.Errorf("cannot get RSI with %d of %d values", rsi.count, rsi.window+1),
+		}
+	}
+	if rsi.avgLoss == 0 {
+		return decimal.NewFromInt(100), nil
+	}
+	rs := rsi.avgGain / rsi.avgLoss
+	return decimal.NewFromFloat(100 - 100/(1+rs)), nil
+}
+
+func (rsi RSI) Value() (decimal.Decimal, error) {
+	return rsi.Get()
+}
+
+func (rsi RSI) Ready() bool {
+	return rsi.count > rsi.window
+}
+
+func (rsi *RSI) Reset() {
+	*rsi = RSI{window: rsi.window}
+}
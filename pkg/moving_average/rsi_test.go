@@ -0,0 +1,64 @@
+package moving_average
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// addValues adds values to an indicator
+func addValues(t *testing.T, indicator Indicator, values []string) {
+	t.Helper()
+	for _, value := range values {
+		indicator.AddValue(decimal.RequireFromString(value))
+	}
+}
+
+// expectValue checks a value of an indicator, rounded to 4 decimals
+func expectValue(t *testing.T, name string, value decimal.Decimal, expected string) {
+	t.Helper()
+	if !value.Round(4).Equal(decimal.RequireFromString(expected)) {
+		t.Errorf("expected %s %s, got %s", name, expected, value)
+	}
+}
+
+func TestRSI(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		window   int
+		values   []string
+		expected string
+	}{
+		{name: "not ready", window: 2, values: []string{"1", "2"}},
+		{name: "only gains", window: 2, values: []string{"1", "2", "3"}, expected: "100"},
+		{name: "only losses", window: 2, values: []string{"3", "2", "1"}, expected: "0"},
+		{name: "flat", window: 2, values: []string{"1", "1", "1"}, expected: "100"},
+		{name: "seeded", window: 2, values: []string{"1", "2", "1"}, expected: "50"},
+		{name: "smoothed", window: 2, values: []string{"1", "2", "1", "0"}, expected: "25"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rsi, err := NewRSI(test.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addValues(t, rsi, test.values)
+			value, err := rsi.Value()
+			if test.expected == "" {
+				if err == nil || rsi.Ready() {
+					t.Errorf("expected RSI not to be ready, got %s", value)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("could not get RSI: %v", err)
+			}
+			expectValue(t, "RSI", value, test.expected)
+			rsi.Reset()
+			if rsi.Ready() {
+				t.Errorf("expected RSI not to be ready after a reset")
+			}
+		})
+	}
+	if _, err := NewRSI(0); err == nil {
+		t.Errorf("expected an error for window 0")
+	}
+}
@@ -45,3 +45,19 @@ func (sma *SimpleMovingAverage) GetCurrentMA() (value decimal.Decimal, err error
 	fSum, _ := sma.sum.Float64()
 	return decimal.NewFromFloat(fSum / float64(len(sma.values))), nil
 }
+
+func (sma *SimpleMovingAverage) Value() (value decimal.Decimal, err error) {
+	return sma.GetCurrentMA()
+}
+
+func (sma *SimpleMovingAverage) Ready() bool {
+	if sma.window < 0 {
+		return len(sma.values) > 0
+	}
+	return len(sma.values) >= sma.window
+}
+
+func (sma *SimpleMovingAverage) Reset() {
+	sma.values = nil
+	sma.sum = decimal.Zero
+}